@@ -2,31 +2,95 @@ package coals
 
 import (
 	"bitbucket.org/mingzhi/gsl/randist"
+	"fmt"
+	"math"
 )
 
-func (w *WFPopulation) Backtrace() {
-	for len(w.history.CurrentPool) > 1 {
+// Backtrace builds the history of the sample back in time.
+// It returns an error, before drawing any event, if Demography, Structure, External or SampleTimes are invalid.
+func (w *WFPopulation) Backtrace() error {
+	if err := w.validate(); err != nil {
+		return err
+	}
+	w.startBacktrace()
+	if w.Structure != nil {
+		w.structuredBacktrace()
+		return nil
+	}
+	if w.External != nil {
+		w.externalBacktrace()
+		return nil
+	}
+	for len(w.history.CurrentPool) > 1 || len(w.pending) > 0 {
 		etype, etime := w.nextEvent()
+		etime, happens := w.advance(etime)
+		if !happens {
+			continue
+		}
 		// based on the type of event, backward
 		if etype == CoalescenceEvent {
 			// do coalescence
-			ancestor := w.coalescent()
+			ancestor := w.coalescent(w.history.CurrentPool)
 			// create event node
 			event := EventNode{Type: etype, Time: etime, Participants: []int{ancestor}}
-			w.history.Events = append(w.history.Events, event)
+			w.history.AddEvent(event)
 		} else {
-			ancestors := w.transfer()
+			ancestors, _ := w.transfer()
 			// create event node
 			event := EventNode{Type: etype, Time: etime, Participants: ancestors}
-			w.history.Events = append(w.history.Events, event)
+			w.history.AddEvent(event)
+		}
+	}
+	return nil
+}
+
+// check the demography, the structure, the external source and the sampling times.
+func (w *WFPopulation) validate() error {
+	if w.Demography != nil {
+		if err := w.Demography.validateCoalescence(); err != nil {
+			return err
+		}
+	}
+	if w.Structure != nil {
+		if w.External != nil {
+			return fmt.Errorf("coals: an external source is not supported in a structured population")
+		}
+		if w.Demography != nil {
+			return fmt.Errorf("coals: a demography is not supported in a structured population")
+		}
+		if err := w.Structure.Validate(w.SampleSize); err != nil {
+			return err
+		}
+		if err := w.Structure.validateMeeting(w.TransferRate > 0 && !w.Structure.LocalTransfer); err != nil {
+			return err
+		}
+	}
+	if w.External != nil {
+		if err := w.External.Validate(); err != nil {
+			return err
 		}
 	}
+	if w.SampleTimes != nil && len(w.SampleTimes) != w.SampleSize {
+		return fmt.Errorf("coals: got %d sampling times for %d genomes", len(w.SampleTimes), w.SampleSize)
+	}
+	return nil
+}
+
+// set the sampling times, index the pool and count the lineages carrying each site.
+func (w *WFPopulation) startBacktrace() {
+	w.setSampleTimes()
+	w.history.indexPool()
+	w.carried = make(map[int]Assembly)
+	w.countLineages()
 }
 
 // determine the next event
 func (w *WFPopulation) nextEvent() (eventType int, eventTime float64) {
 	k := float64(len(w.history.CurrentPool))
 	p := 2.0 * w.TransferRate * float64(w.Size)
+	if w.Demography != nil {
+		return w.nextDemographicEvent(k, p)
+	}
 	l := (k*p + k*(k-1.0)) / 2.0
 	v := randist.ExponentialRandomFloat64(w.rng, 1.0/l)
 	eventTime = v
@@ -39,87 +103,99 @@ func (w *WFPopulation) nextEvent() (eventType int, eventTime float64) {
 	return
 }
 
-// do coalescent
-func (w *WFPopulation) coalescent() int {
-	// randomly choose two nodes
-	a := w.history.CurrentPool[randist.UniformRandomInt(w.rng, len(w.history.CurrentPool))]
-	b := w.history.CurrentPool[randist.UniformRandomInt(w.rng, len(w.history.CurrentPool))]
-	for a == b {
-		b = w.history.CurrentPool[randist.UniformRandomInt(w.rng, len(w.history.CurrentPool))]
+// determine the next event under the demography,
+// where the coalescence rate of a pair is Size over the population size at the time,
+// and transfers keep their rate k*p/2, being per genome and generation.
+func (w *WFPopulation) nextDemographicEvent(k, p float64) (eventType int, eventTime float64) {
+	now := w.now
+	x := randist.ExponentialRandomFloat64(w.rng, 1.0) / (k * (k - 1.0) / 2.0)
+	tc := w.Demography.coalescenceTime(now, x, float64(w.Size)) - now
+	tt := math.Inf(1)
+	if p > 0 {
+		tt = randist.ExponentialRandomFloat64(w.rng, 2.0/(k*p))
 	}
+	if math.IsInf(tc, 1) && math.IsInf(tt, 1) && len(w.pending) == 0 {
+		panic("coals: lineages never coalesce under the demography")
+	}
+	if tt < tc {
+		return TransferEvent, tt
+	}
+	return CoalescenceEvent, tc
+}
 
-	aTreeNode := w.history.Tree[a]
-	bTreeNode := w.history.Tree[b]
+// do coalescent of two nodes chosen from the candidates
+func (w *WFPopulation) coalescent(candidates []int) int {
+	// randomly choose two nodes
+	i := randist.UniformRandomInt(w.rng, len(candidates))
+	j := randist.UniformRandomInt(w.rng, len(candidates)-1)
+	if j >= i {
+		j++
+	}
+	a, b := candidates[i], candidates[j]
 
 	// create their ancestor tree node and add it into the tree
-	genome := Merge(aTreeNode.Genome, bTreeNode.Genome)
+	amA, amB := w.material(a), w.material(b)
+	genome := Merge(amA, amB)
 	children := []int{a, b}
-	w.history.Tree = append(w.history.Tree, TreeNode{Genome: genome, Children: children})
+	w.history.Tree = append(w.history.Tree, TreeNode{Genome: genome, Children: children, Deme: w.history.Tree[a].Deme})
+	ancestorID := len(w.history.Tree) - 1
 
-	// update the current pool
-	pool := []int{}
-	for _, pos := range w.history.CurrentPool {
-		if pos != a && pos != b {
-			pool = append(pool, pos)
+	// update the current pool, where the ancestor carries up the material without a common ancestor yet
+	w.release(a)
+	w.release(b)
+	carried, pruned := w.prune(amA, amB, genome)
+	if len(carried) > 0 || len(w.history.CurrentPool) == 0 {
+		w.history.addLineage(ancestorID)
+		if pruned {
+			w.carried[ancestorID] = carried
 		}
 	}
-	ancestorID := len(w.history.Tree) - 1
-	pool = append(pool, ancestorID)
-	w.history.CurrentPool = pool
 
 	return ancestorID
 }
 
-// do transfer
-func (w *WFPopulation) transfer() (parents []int) {
+// remove a lineage from the pool, with the material it carries.
+func (w *WFPopulation) release(c int) {
+	w.history.removeLineage(c)
+	delete(w.carried, c)
+}
+
+// do transfer, returning the parents and the one carrying the transferred tract, -1 if there is none.
+// The parents are in the deme of the receiver.
+func (w *WFPopulation) transfer() (parents []int, tract int) {
+	tract = -1
 	// randomly choose a node
 	c := w.history.CurrentPool[randist.UniformRandomInt(w.rng, len(w.history.CurrentPool))]
-	// tranferring fragment
-	begin := randist.UniformRandomInt(w.rng, w.GenomeLength)
-	end := begin + w.TransferLength
-	if end < w.GenomeLength {
-		amA, amB := Split(w.history.Tree[c].Genome, begin, end)
-		if len(amA) != 0 {
-			genome := amA
-			children := []int{c}
-			w.history.Tree = append(w.history.Tree, TreeNode{Genome: genome, Children: children})
-			parents = append(parents, len(w.history.Tree)-1)
-		}
-
-		if len(amB) != 0 {
-			genome := amB
-			children := []int{c}
-			w.history.Tree = append(w.history.Tree, TreeNode{Genome: genome, Children: children})
-			parents = append(parents, len(w.history.Tree)-1)
-		}
-	} else {
-		amB, amA := Split(w.history.Tree[c].Genome, end-w.GenomeLength+1, begin-1)
-		if len(amA) != 0 {
-			genome := amA
-			children := []int{c}
-			w.history.Tree = append(w.history.Tree, TreeNode{Genome: genome, Children: children})
-			parents = append(parents, len(w.history.Tree)-1)
-		}
+	// tranferring fragment, of TransferLength sites in the genome topology
+	lo, hi := w.Topology.Starts(w.TransferLength, w.GenomeLength)
+	begin := lo + randist.UniformRandomInt(w.rng, hi-lo)
+	amA := w.material(c)
+	var amB Assembly
+	for _, t := range w.Topology.Tract(begin, w.TransferLength, w.GenomeLength) {
+		var part Assembly
+		amA, part = Split(amA, t[0], t[1]-1)
+		amB = Merge(amB, part)
+	}
+	if len(amA) != 0 {
+		genome := amA
+		children := []int{c}
+		w.history.Tree = append(w.history.Tree, TreeNode{Genome: genome, Children: children, Deme: w.history.Tree[c].Deme})
+		parents = append(parents, len(w.history.Tree)-1)
+	}
 
-		if len(amB) != 0 {
-			genome := amB
-			children := []int{c}
-			w.history.Tree = append(w.history.Tree, TreeNode{Genome: genome, Children: children})
-			parents = append(parents, len(w.history.Tree)-1)
-		}
+	if len(amB) != 0 {
+		genome := amB
+		children := []int{c}
+		w.history.Tree = append(w.history.Tree, TreeNode{Genome: genome, Children: children, Deme: w.history.Tree[c].Deme, Tract: true})
+		parents = append(parents, len(w.history.Tree)-1)
+		tract = len(w.history.Tree) - 1
 	}
 
 	// update the current pool
-	pool := []int{}
-	for _, pos := range w.history.CurrentPool {
-		if pos != c {
-			pool = append(pool, pos)
-		}
-	}
+	w.release(c)
 	for _, pos := range parents {
-		pool = append(pool, pos)
+		w.history.addLineage(pos)
 	}
-	w.history.CurrentPool = pool
 
 	return
 }
@@ -3,22 +3,39 @@ package coals
 import (
 	"bitbucket.org/mingzhi/gsl/randist"
 	"encoding/json"
+	"fmt"
+	"github.com/mingzhi/hgt/genome"
+	"io"
 	"sort"
+	"strings"
 )
 
 const (
 	CoalescenceEvent = 0
 	TransferEvent    = 1
+	MigrationEvent   = 2 // a lineage moves to another deme, backward in time
 )
 
 type WFPopulation struct {
-	Size           int     // population size
-	SampleSize     int     // sample size
-	GenomeLength   int     // genome length
-	MutationRate   float64 // mutation rate
-	TransferRate   float64 // transfer rate per genome
-	TransferLength int     // transfer fragment length
+	Size           int               // population size
+	SampleSize     int               // sample size
+	GenomeLength   int               // genome length
+	MutationRate   float64           // mutation rate
+	TransferRate   float64           // transfer rate per genome, over the positions of Topology.Starts
+	TransferLength int               // transfer fragment length
+	Topology       genome.Topology   // genome topology, circular by default as in fwd.SeqPop
+	Demography     Demography        // sizes over time, Size being the reference size of the time unit; constant Size if nil
+	Structure      *Structure        // demes and migration, panmictic if nil
+	External       *External         // unsampled source of transfers, in deme 1; transfers within the sample only if nil
+	SampleTimes    []float64         // sampling time of each sampled genome, in units of Size generations before the present; all at the present if nil
+	Model          SubstitutionModel `json:"-"` // substitution model of Fortrace, Jukes-Cantor if nil
 	history        *EvolutionHistory
+	ancestral      []byte           // ancestral sequence at the root, generated by Fortrace
+	mutations      []Mutation       // mutations placed by Fortrace
+	now            float64          // current time of Backtrace
+	pending        []int            // sampled genomes not yet in the pool of Backtrace, older last
+	carried        map[int]Assembly // material carried up by lineages of the pool, when less than their Genome
+	coverage       coverage         // numbers of lineages carrying each site in Backtrace
 
 	rng *randist.RNG
 }
@@ -41,12 +58,34 @@ func (w *WFPopulation) GetHistory() *EvolutionHistory {
 	return w.history
 }
 
+// Ancestral returns the sequence at the root of the last Fortrace.
+func (w *WFPopulation) Ancestral() []byte {
+	return w.ancestral
+}
+
 func (w *WFPopulation) Seed(seed int) {
 	w.rng.SetSeed(seed)
 }
 
+// savedPopulation: the parameters and the history of a population in JSON.
+type savedPopulation struct {
+	Size           int
+	SampleSize     int
+	GenomeLength   int
+	MutationRate   float64
+	TransferRate   float64
+	TransferLength int
+	Topology       genome.Topology
+	Demography     Demography
+	Structure      *Structure
+	External       *External
+	SampleTimes    []float64
+	History        *EvolutionHistory
+}
+
+// Json returns the parameters and the history in JSON format, as saved by Save.
 func (w *WFPopulation) Json() []byte {
-	b, err := json.Marshal(w)
+	b, err := json.Marshal(w.saved())
 	if err != nil {
 		panic(err)
 	}
@@ -54,12 +93,62 @@ func (w *WFPopulation) Json() []byte {
 	return b
 }
 
+func (w *WFPopulation) saved() savedPopulation {
+	return savedPopulation{
+		Size:           w.Size,
+		SampleSize:     w.SampleSize,
+		GenomeLength:   w.GenomeLength,
+		MutationRate:   w.MutationRate,
+		TransferRate:   w.TransferRate,
+		TransferLength: w.TransferLength,
+		Topology:       w.Topology,
+		Demography:     w.Demography,
+		Structure:      w.Structure,
+		External:       w.External,
+		SampleTimes:    w.SampleTimes,
+		History:        w.history,
+	}
+}
+
+// Save writes the parameters and the history, so that the history can be loaded by LoadWFPopulation.
+func (w *WFPopulation) Save(wr io.Writer) error {
+	return json.NewEncoder(wr).Encode(w.saved())
+}
+
+// LoadWFPopulation reads a population written by Save.
+// Its history is ready for Fortrace, which can be rerun
+// after changing MutationRate or Model to sample other mutations on the same genealogy.
+func LoadWFPopulation(r io.Reader) (*WFPopulation, error) {
+	var saved savedPopulation
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return nil, err
+	}
+	if saved.History == nil || len(saved.History.Tree) < saved.SampleSize {
+		return nil, fmt.Errorf("coals: saved population has no history of %d genomes", saved.SampleSize)
+	}
+
+	w := NewWFPopulation(saved.Size, saved.SampleSize, saved.GenomeLength,
+		saved.MutationRate, saved.TransferRate, saved.TransferLength)
+	w.Topology = saved.Topology
+	w.Demography = saved.Demography
+	w.Structure = saved.Structure
+	w.External = saved.External
+	w.SampleTimes = saved.SampleTimes
+	w.history = saved.History
+	// times and parents are recomputed, for histories saved without them
+	w.history.Link()
+	return w, nil
+}
+
 type Fragment struct {
 	Begin    int    // begin position of this fragment
 	End      int    // end position of this fragment
 	Sequence []byte // fragment sequence
 }
 
+// Assembly: ancestral material as fragments sorted by their begin positions and disjoint,
+// as returned by Merge, Split and Intersect, which work on such assemblies in linear time.
+// They still accept unsorted assemblies, sorting a copy first.
 type Assembly []Fragment
 
 // interface functions for sort package
@@ -67,74 +156,117 @@ func (a Assembly) Len() int           { return len(a) }
 func (a Assembly) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a Assembly) Less(i, j int) bool { return a[i].Begin < a[j].Begin }
 
+// the assembly itself if it is sorted, otherwise a sorted copy.
+func sorted(a Assembly) Assembly {
+	if sort.IsSorted(a) {
+		return a
+	}
+	return sortedCopy(a)
+}
+
+func sortedCopy(a Assembly) Assembly {
+	b := make(Assembly, len(a))
+	copy(b, a)
+	sort.Sort(b)
+	return b
+}
+
 func Merge(a, b Assembly) (c Assembly) {
-	temp := Assembly{}
-	for _, frag := range a {
-		temp = append(temp, frag)
-	}
-	for _, frag := range b {
-		temp = append(temp, frag)
-	}
-
-	if len(temp) > 0 {
-		sort.Sort(temp)
-		begin := temp[0].Begin
-		end := temp[0].End
-		for _, frag := range temp {
-			if frag.Begin <= end {
-				if frag.End > end {
-					end = frag.End
-				}
-			} else {
-				c = append(c, Fragment{Begin: begin, End: end})
-				begin = frag.Begin
-				end = frag.End
+	a, b = sorted(a), sorted(b)
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		// the next fragment by its begin position
+		var frag Fragment
+		if j == len(b) || (i < len(a) && a[i].Begin <= b[j].Begin) {
+			frag = a[i]
+			i++
+		} else {
+			frag = b[j]
+			j++
+		}
+		if n := len(c); n > 0 && frag.Begin <= c[n-1].End {
+			if frag.End > c[n-1].End {
+				c[n-1].End = frag.End
 			}
+		} else {
+			c = append(c, Fragment{Begin: frag.Begin, End: frag.End})
 		}
-		c = append(c, Fragment{Begin: begin, End: end})
 	}
 
 	return
 }
 
 func Split(a Assembly, begin, end int) (b, c Assembly) {
-	sort.Sort(a)
+	a = sorted(a)
 	// find the first fragment, which begin index is in
 	idxL := sort.Search(len(a), func(i int) bool { return a[i].End >= begin })
 	idxR := sort.Search(len(a), func(i int) bool { return a[i].Begin > end })
-	for i, _ := range a {
-		if i >= idxL && i < idxR {
-			if begin <= a[i].Begin {
-				begin = a[i].Begin
-			} else {
-				b = append(b, Fragment{Begin: a[i].Begin, End: begin - 1})
-			}
-			if end >= a[i].End {
-				c = append(c, Fragment{Begin: begin, End: a[i].End})
-			} else {
-				c = append(c, Fragment{Begin: begin, End: end})
-				b = append(b, Fragment{Begin: end + 1, End: a[i].End})
-			}
+	b = append(b, a[:idxL]...)
+	for i := idxL; i < idxR; i++ {
+		if begin <= a[i].Begin {
+			begin = a[i].Begin
 		} else {
-			b = append(b, a[i])
+			b = append(b, Fragment{Begin: a[i].Begin, End: begin - 1})
+		}
+		if end >= a[i].End {
+			c = append(c, Fragment{Begin: begin, End: a[i].End})
+		} else {
+			c = append(c, Fragment{Begin: begin, End: end})
+			b = append(b, Fragment{Begin: end + 1, End: a[i].End})
 		}
 	}
+	b = append(b, a[idxR:]...)
 
 	return
 }
 
+// Intersect returns the ancestral material shared by two assemblies.
+func Intersect(a, b Assembly) (c Assembly) {
+	a, b = sorted(a), sorted(b)
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		begin, end := a[i].Begin, a[i].End
+		if b[j].Begin > begin {
+			begin = b[j].Begin
+		}
+		if b[j].End < end {
+			end = b[j].End
+		}
+		if begin <= end {
+			c = append(c, Fragment{Begin: begin, End: end})
+		}
+		if a[i].End < b[j].End {
+			i++
+		} else {
+			j++
+		}
+	}
+	return
+}
+
+// String returns the fragments as "[begin,end] [begin,end] ...".
+func (a Assembly) String() string {
+	parts := make([]string, len(a))
+	for i, frag := range a {
+		parts[i] = fmt.Sprintf("[%d,%d]", frag.Begin, frag.End)
+	}
+	return strings.Join(parts, " ")
+}
+
 type EvolutionHistory struct {
 	CurrentPool []int
 	Tree        []TreeNode
 	Events      []EventNode
+	Tracts      bool        // whether the tree nodes mark the lineages of transferred tracts, false in histories saved before they did
+	poolIndex   map[int]int // position of each lineage in CurrentPool
 }
 
 func NewEvolutionHistory(size, length int) *EvolutionHistory {
-	history := EvolutionHistory{}
+	history := EvolutionHistory{Tracts: true}
 	// initilize the current pool and tree leave
 	for i := 0; i < size; i++ {
 		history.CurrentPool = append(history.CurrentPool, i)
-		history.Tree = append(history.Tree, TreeNode{Genome: Assembly{Fragment{Begin: 0, End: length - 1}}})
+		history.Tree = append(history.Tree, TreeNode{Genome: Assembly{Fragment{Begin: 0, End: length - 1}}, Event: -1})
 	}
 
 	return &history
@@ -143,6 +275,66 @@ func NewEvolutionHistory(size, length int) *EvolutionHistory {
 type TreeNode struct {
 	Genome   Assembly
 	Children []int
+	Parents  []int   // parents, two for a genome receiving a transfer
+	Time     float64 // absolute time, 0 for the sampled genomes
+	Event    int     // index of the event creating this node, -1 for the sampled genomes
+	Deme     int     // deme of the lineage, 0 in a panmictic population
+	Tract    bool    // the lineage of a transferred tract, from the donor, created by a transfer event
+}
+
+// AddEvent appends an event whose participants are already in the tree,
+// and links them with their absolute time, the event, and their children.
+func (h *EvolutionHistory) AddEvent(event EventNode) {
+	t := event.Time
+	if n := len(h.Events); n > 0 {
+		t += h.Tree[h.Events[n-1].Participants[0]].Time
+	}
+	for _, p := range event.Participants {
+		h.Tree[p].Time = t
+		h.Tree[p].Event = len(h.Events)
+		for _, c := range h.Tree[p].Children {
+			h.Tree[c].Parents = append(h.Tree[c].Parents, p)
+		}
+	}
+	h.Events = append(h.Events, event)
+}
+
+// Link sets the times, parents and events of the tree nodes from the events and the children,
+// for a history built without AddEvent, such as one decoded from an older JSON.
+// The sampled genomes keep their times.
+func (h *EvolutionHistory) Link() {
+	events := h.Events
+	h.Events = nil
+	for i := range h.Tree {
+		h.Tree[i].Parents = nil
+		if len(h.Tree[i].Children) > 0 {
+			h.Tree[i].Time = 0
+		}
+		h.Tree[i].Event = -1
+	}
+	for _, event := range events {
+		h.AddEvent(event)
+	}
+}
+
+// TMRCA returns the time of the root of the history,
+// the grand most recent common ancestor of all the ancestral material.
+func (h *EvolutionHistory) TMRCA() float64 {
+	if len(h.Events) == 0 {
+		return 0
+	}
+	return h.Tree[h.Events[len(h.Events)-1].Participants[0]].Time
+}
+
+// TotalBranchLength returns the total length of the lineages of the history,
+// each lineage counted from its node until the event ending it.
+func (h *EvolutionHistory) TotalBranchLength() (length float64) {
+	for _, node := range h.Tree {
+		if len(node.Parents) > 0 {
+			length += h.Tree[node.Parents[0]].Time - node.Time
+		}
+	}
+	return
 }
 
 type EventNode struct {
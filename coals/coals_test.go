@@ -1,6 +1,9 @@
 package coals
 
-import "testing"
+import (
+	"bytes"
+	"testing"
+)
 
 func TestMerge(t *testing.T) {
 	frag1 := Fragment{Begin: 0, End: 100}
@@ -67,3 +70,47 @@ func TestSplit(t *testing.T) {
 		t.Errorf("Expected to get 49, but got %d", b[1].End)
 	}
 }
+
+func TestSaveLoad(t *testing.T) {
+	w := NewWFPopulation(1000, 10, 1000, 1e-4, 2e-3, 100)
+	w.Seed(1)
+	if err := w.Backtrace(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := w.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	v, err := LoadWFPopulation(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Size != w.Size || v.SampleSize != w.SampleSize || v.TransferRate != w.TransferRate {
+		t.Errorf("expected parameters %s, but got %s", w.Json(), v.Json())
+	}
+	if !bytes.Equal(v.Json(), w.Json()) {
+		t.Errorf("loaded history differs from the saved one")
+	}
+
+	// the same seed gives the same sequences on the loaded history
+	w.Seed(2)
+	v.Seed(2)
+	seqs, loaded := w.Fortrace(), v.Fortrace()
+	for i := 0; i < w.SampleSize; i++ {
+		if !bytes.Equal(seqs[i], loaded[i]) {
+			t.Errorf("sequence %d differs on the loaded history", i)
+		}
+	}
+
+	// more mutations with a higher rate on the same history
+	v.MutationRate *= 10
+	v.Model = Kimura{Kappa: 2}
+	v.Fortrace()
+	if len(v.Mutations()) < 5*len(w.Mutations()) {
+		t.Errorf("expected about 10 times %d mutations, but got %d", len(w.Mutations()), len(v.Mutations()))
+	}
+
+	if _, err := LoadWFPopulation(bytes.NewBufferString("{}")); err == nil {
+		t.Errorf("expected an error loading a population without history")
+	}
+}
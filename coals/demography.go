@@ -0,0 +1,138 @@
+package coals
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Epoch: a period of the demography, going back in time from Start,
+// in which the size t generations ago is Size * exp(-Growth * (t - Start)).
+// A positive Growth means the population grew forward in time, as in ms.
+type Epoch struct {
+	Start  float64 // generations before the present when the epoch begins
+	Size   float64 // population size at Start
+	Growth float64 // exponential growth rate per generation, 0 for a constant size
+}
+
+// Demography: epochs sorted by their start, the first one starting at the present.
+// The same demography drives the coalescent and, by resizing, the forward simulations.
+type Demography []Epoch
+
+// ParseDemography parses epochs "start:size[:growth]" separated by commas, in any order,
+// such as "0:1000:0.0115,200:100" for a population of 100 genomes
+// that grew exponentially to 1000 genomes over the last 200 generations.
+func ParseDemography(s string) (Demography, error) {
+	d := Demography{}
+	for _, field := range strings.Split(s, ",") {
+		values := strings.Split(strings.TrimSpace(field), ":")
+		if len(values) < 2 || len(values) > 3 {
+			return nil, fmt.Errorf("demography: expected start:size[:growth], got %q", field)
+		}
+		e := Epoch{}
+		var err error
+		if e.Start, err = strconv.ParseFloat(values[0], 64); err != nil {
+			return nil, fmt.Errorf("demography: invalid start %q", values[0])
+		}
+		if e.Size, err = strconv.ParseFloat(values[1], 64); err != nil {
+			return nil, fmt.Errorf("demography: invalid size %q", values[1])
+		}
+		if len(values) == 3 {
+			if e.Growth, err = strconv.ParseFloat(values[2], 64); err != nil {
+				return nil, fmt.Errorf("demography: invalid growth %q", values[2])
+			}
+		}
+		d = append(d, e)
+	}
+	sort.SliceStable(d, func(i, j int) bool { return d[i].Start < d[j].Start })
+	return d, d.Validate()
+}
+
+// Validate checks the epochs start at the present, in order, with positive and finite sizes and growth rates.
+func (d Demography) Validate() error {
+	if len(d) == 0 || d[0].Start != 0 {
+		return fmt.Errorf("demography: the first epoch should start at 0")
+	}
+	for i, e := range d {
+		if !(e.Size > 0) || math.IsInf(e.Size, 1) {
+			return fmt.Errorf("demography: size of epoch %d should be positive", i)
+		}
+		if math.IsNaN(e.Growth) || math.IsInf(e.Growth, 0) {
+			return fmt.Errorf("demography: growth of epoch %d should be finite", i)
+		}
+		if i > 0 && e.Start <= d[i-1].Start {
+			return fmt.Errorf("demography: epochs should start at increasing times")
+		}
+	}
+	return nil
+}
+
+// SizeAt returns the population size t generations ago.
+func (d Demography) SizeAt(t float64) float64 {
+	e := d[d.epoch(t)]
+	return e.Size * math.Exp(-e.Growth*(t-e.Start))
+}
+
+// index of the epoch containing time t.
+func (d Demography) epoch(t float64) int {
+	i := sort.Search(len(d), func(i int) bool { return d[i].Start > t })
+	if i == 0 {
+		return 0
+	}
+	return i - 1
+}
+
+// validateCoalescence checks the demography is valid
+// and that lineages coalesce under it with probability one:
+// the last epoch should not grow back in time (a negative Growth),
+// since the total coalescence intensity would then be finite.
+func (d Demography) validateCoalescence() error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	if last := d[len(d)-1]; last.Growth < 0 {
+		return fmt.Errorf("demography: lineages may never coalesce, the last epoch grows without bound back in time")
+	}
+	return nil
+}
+
+// coalescenceTime returns the time after time now at which the coalescence intensity of a pair,
+// the integral of its rate size/N(t), reaches x.
+// Times are in units of size generations, size being the reference size of the coalescent.
+// It returns +Inf if the intensity never reaches x, in a last epoch growing back in time.
+func (d Demography) coalescenceTime(now, x, size float64) float64 {
+	for i := d.epoch(now * size); i < len(d); i++ {
+		e := d[i]
+		start := e.Start / size  // scaled start of the epoch
+		nu := e.Size / size      // scaled size at the start
+		alpha := e.Growth * size // scaled growth rate
+		end := math.Inf(1)       // scaled end of the epoch
+		if i+1 < len(d) {
+			end = d[i+1].Start / size
+		}
+
+		// intensity from now until t is (exp(alpha*(t-start)) - exp(alpha*(now-start))) / (alpha*nu)
+		var t float64
+		if alpha == 0 {
+			t = now + nu*x
+		} else if v := math.Exp(alpha*(now-start)) + alpha*nu*x; v > 0 {
+			t = start + math.Log(v)/alpha
+		} else {
+			t = math.Inf(1)
+		}
+		if t <= end {
+			return t
+		}
+
+		// use up the intensity of the rest of the epoch
+		if alpha == 0 {
+			x -= (end - now) / nu
+		} else {
+			x -= (math.Exp(alpha*(end-start)) - math.Exp(alpha*(now-start))) / (alpha * nu)
+		}
+		now = end
+	}
+	return math.Inf(1)
+}
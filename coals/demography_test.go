@@ -0,0 +1,109 @@
+package coals
+
+import (
+	"github.com/mingzhi/hgt/simtest"
+	"math"
+	"testing"
+)
+
+func TestParseDemography(t *testing.T) {
+	d, err := ParseDemography("200:100,0:1000:0.01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d) != 2 || d[0].Start != 0 || d[1].Size != 100 {
+		t.Fatalf("unexpected demography %v", d)
+	}
+	if s := d.SizeAt(100); math.Abs(s-1000*math.Exp(-1)) > 1e-9 {
+		t.Errorf("expected size %g at 100, but got %g", 1000*math.Exp(-1), s)
+	}
+	if s := d.SizeAt(300); s != 100 {
+		t.Errorf("expected size 100 at 300, but got %g", s)
+	}
+
+	// the documented example grows from 100 to 1000 genomes
+	d, err = ParseDemography("0:1000:0.0115,200:100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := d.SizeAt(199.9); math.Abs(s-100) > 1 {
+		t.Errorf("expected about 100 genomes at 200 generations ago, but got %g", s)
+	}
+
+	for _, s := range []string{"", "10:100", "0:-1", "0:100,0:10", "0:x", "0:NaN", "0:Inf", "0:100:NaN"} {
+		if _, err := ParseDemography(s); err == nil {
+			t.Errorf("expected an error parsing %q", s)
+		}
+	}
+}
+
+func TestCoalescenceTime(t *testing.T) {
+	size := 1000.0
+	d := Demography{{Start: 0, Size: 1000}, {Start: 500, Size: 2000}}
+	if c := d.coalescenceTime(0, 0.2, size); math.Abs(c-0.2) > 1e-12 {
+		t.Errorf("expected 0.2, but got %g", c)
+	}
+	if c := d.coalescenceTime(0.1, 1, size); math.Abs(c-1.7) > 1e-12 {
+		t.Errorf("expected 1.7, but got %g", c)
+	}
+
+	// the intensity up to the time is x, integrated numerically
+	d = Demography{{Start: 0, Size: 1000, Growth: 0.002}, {Start: 300, Size: 200, Growth: -0.001}}
+	now, x := 0.1, 0.8
+	c := d.coalescenceTime(now, x, size)
+	steps := 100000
+	intensity := 0.0
+	for i := 0; i < steps; i++ {
+		u := now + (c-now)*(float64(i)+0.5)/float64(steps)
+		intensity += (c - now) / float64(steps) * size / d.SizeAt(u*size)
+	}
+	if math.Abs(intensity-x) > 1e-4 {
+		t.Errorf("expected intensity %g up to %g, but got %g", x, c, intensity)
+	}
+
+	// a population growing back in time may never coalesce
+	d = Demography{{Start: 0, Size: 1000, Growth: -0.01}}
+	if c := d.coalescenceTime(0, 100, size); !math.IsInf(c, 1) {
+		t.Errorf("expected no coalescence, but got %g", c)
+	}
+}
+
+// the coalescence time of two genomes in a constant population is exponential,
+// of mean the size over the reference size.
+func TestDemographicBacktrace(t *testing.T) {
+	w := NewWFPopulation(1000, 2, 100, 0, 0, 10)
+	w.Demography = Demography{{Start: 0, Size: 2000}}
+	times := simtest.Replicate(2000, simtest.Seed(t), func(seed int) float64 {
+		w.Seed(seed)
+		w.history = NewEvolutionHistory(2, 100)
+		if err := w.Backtrace(); err != nil {
+			t.Fatal(err)
+		}
+		return w.history.TMRCA()
+	})
+	f := simtest.NewFamily(t, 1e-3)
+	f.Mean("coalescence time", times, 2)
+	f.KS("coalescence time", times, simtest.ExponentialCDF(2))
+	f.Check()
+}
+
+func TestDemographyNeverCoalesces(t *testing.T) {
+	for _, d := range []Demography{
+		{{Start: 0, Size: 1000, Growth: -0.01}},
+		{{Start: 0, Size: 1000}, {Start: 100, Size: 500, Growth: -0.001}},
+		{{Start: 0, Size: 1000}, {Start: 100, Size: 0}},
+	} {
+		w := NewWFPopulation(1000, 5, 100, 0, 1e-3, 10)
+		w.Demography = d
+		if err := w.Backtrace(); err == nil {
+			t.Errorf("expected an error for demography %v", d)
+		}
+	}
+
+	// growth back in time is fine before the last epoch
+	w := NewWFPopulation(1000, 5, 100, 0, 1e-3, 10)
+	w.Demography = Demography{{Start: 0, Size: 1000, Growth: -0.01}, {Start: 100, Size: 500}}
+	if err := w.Backtrace(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,117 @@
+package coals
+
+import (
+	"bitbucket.org/mingzhi/gsl/randist"
+	"fmt"
+	"math"
+)
+
+// External: an unsampled source of transfers, such as a divergent population or species.
+// A fraction of the transfers into the sampled population have their donors in the source,
+// the tract then following a ghost lineage of the source, in deme 1,
+// which coalesces only with other ghost lineages until the source joins the sampled population,
+// Divergence generations ago, going back in time.
+// Ghost lineages receive transfers from the source only.
+type External struct {
+	Fraction   float64 // fraction of the transfers into the sampled population coming from the source
+	Size       float64 // number of genomes in the source
+	Divergence float64 // generations ago when the source split from the sampled population
+}
+
+// Validate checks the fraction is a probability, the size is positive and the divergence time finite.
+func (e *External) Validate() error {
+	if e.Fraction < 0 || e.Fraction > 1 {
+		return fmt.Errorf("external: fraction should be in [0, 1], got %g", e.Fraction)
+	}
+	if e.Size <= 0 {
+		return fmt.Errorf("external: size of the source should be positive, got %g", e.Size)
+	}
+	if e.Divergence < 0 || math.IsInf(e.Divergence, 0) || math.IsNaN(e.Divergence) {
+		return fmt.Errorf("external: divergence time should be finite and not negative, got %g", e.Divergence)
+	}
+	return nil
+}
+
+// deme of the ghost lineages of the source
+const ghostDeme = 1
+
+// backtrace the coalescent with an external source of transfers.
+// In units of Size generations, two ghost lineages coalesce at rate Size/External.Size,
+// two lineages of the sampled population at rate 1, or under the Demography,
+// and every lineage receives a transfer at rate Size*TransferRate.
+// When the source joins, each ghost lineage migrates into the sampled population.
+func (w *WFPopulation) externalBacktrace() {
+	e := w.External
+	h := w.history
+	size := float64(w.Size)
+	p := 2.0 * w.TransferRate * size
+	divergence := e.Divergence / size
+	for len(h.CurrentPool) > 1 || len(w.pending) > 0 {
+		demes := make([][]int, 2)
+		for _, c := range h.CurrentPool {
+			demes[h.Tree[c].Deme] = append(demes[h.Tree[c].Deme], c)
+		}
+		k := float64(len(demes[0]))
+		g := float64(len(demes[ghostDeme]))
+
+		// coalescence in the sampled population competes with ghost coalescence and transfers
+		coalescence := math.Inf(1)
+		if k > 1 {
+			x := randist.ExponentialRandomFloat64(w.rng, 1.0) / (k * (k - 1.0) / 2.0)
+			if w.Demography != nil {
+				coalescence = w.Demography.coalescenceTime(w.now, x, size) - w.now
+			} else {
+				coalescence = x
+			}
+		}
+		rates := []float64{g * (g - 1.0) / 2.0 * size / e.Size, (k + g) * p / 2.0}
+		etype, etime, deme := CoalescenceEvent, coalescence, 0
+		if other := rates[0] + rates[1]; other > 0 {
+			if t := randist.ExponentialRandomFloat64(w.rng, 1.0/other); t < etime {
+				etime = t
+				if randist.UniformRandomFloat64(w.rng)*other < rates[0] {
+					deme = ghostDeme
+				} else {
+					etype = TransferEvent
+				}
+			}
+		}
+
+		// the source joins before the event, unless a sampled genome enters the pool first
+		if g > 0 && w.now+etime > divergence && (len(w.pending) == 0 || h.Tree[w.pending[0]].Time >= divergence) {
+			w.joinSource(demes[ghostDeme], divergence)
+			continue
+		}
+		if math.IsInf(etime, 1) && len(w.pending) == 0 {
+			panic("coals: lineages never coalesce with the external source")
+		}
+		etime, happens := w.advance(etime)
+		if !happens {
+			continue
+		}
+
+		if etype == CoalescenceEvent {
+			ancestor := w.coalescent(demes[deme])
+			h.AddEvent(EventNode{Type: CoalescenceEvent, Time: etime, Participants: []int{ancestor}})
+		} else {
+			ancestors, tract := w.transfer()
+			if tract >= 0 {
+				receiver := h.Tree[h.Tree[tract].Children[0]].Deme
+				if receiver == 0 && w.now < divergence && randist.UniformRandomFloat64(w.rng) < e.Fraction {
+					h.Tree[tract].Deme = ghostDeme
+				}
+			}
+			h.AddEvent(EventNode{Type: TransferEvent, Time: etime, Participants: ancestors})
+		}
+	}
+}
+
+// move the ghost lineages into the sampled population at time divergence.
+func (w *WFPopulation) joinSource(ghosts []int, divergence float64) {
+	h := w.history
+	for _, c := range ghosts {
+		ancestor := w.migrate(c, 0)
+		h.AddEvent(EventNode{Type: MigrationEvent, Time: divergence - h.TMRCA(), Participants: []int{ancestor}})
+	}
+	w.now = divergence
+}
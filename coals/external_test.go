@@ -0,0 +1,85 @@
+package coals
+
+import (
+	"testing"
+)
+
+func TestExternalBacktrace(t *testing.T) {
+	w := NewWFPopulation(1000, 10, 1000, 1e-4, 5e-3, 100)
+	w.External = &External{Fraction: 1, Size: 500, Divergence: 5000}
+	w.Seed(1)
+	if err := w.Backtrace(); err != nil {
+		t.Fatal(err)
+	}
+	h := w.GetHistory()
+	if len(h.CurrentPool) != 1 {
+		t.Fatalf("expected a single root, but got %v", h.CurrentPool)
+	}
+
+	divergence := 5.0
+	ghosts, joins := 0, 0
+	for _, event := range h.Events {
+		a := h.Tree[event.Participants[0]]
+		switch event.Type {
+		case CoalescenceEvent:
+			for _, c := range a.Children {
+				if h.Tree[c].Deme != a.Deme {
+					t.Fatalf("lineages of demes %d and %d coalesce", h.Tree[a.Children[0]].Deme, h.Tree[a.Children[1]].Deme)
+				}
+			}
+		case MigrationEvent:
+			joins++
+			if a.Time != divergence || a.Deme != 0 {
+				t.Fatalf("expected ghost lineages to join the sample at %g, but got deme %d at %g", divergence, a.Deme, a.Time)
+			}
+		case TransferEvent:
+			for _, p := range event.Participants {
+				if h.Tree[p].Deme == ghostDeme {
+					ghosts++
+					if h.Tree[p].Time >= divergence {
+						t.Fatalf("a ghost lineage after the divergence at %g", h.Tree[p].Time)
+					}
+				}
+			}
+		}
+	}
+	if ghosts == 0 {
+		t.Error("expected transfers from the source")
+	}
+	if joins == 0 {
+		t.Error("expected ghost lineages to join the sampled population")
+	}
+
+	// external tracts bring divergent sequences into the sample
+	seqs := w.Fortrace()
+	if len(seqs) != 10 {
+		t.Errorf("expected 10 sequences, but got %d", len(seqs))
+	}
+}
+
+func TestExternalWithoutTransfers(t *testing.T) {
+	w := NewWFPopulation(1000, 10, 1000, 1e-4, 5e-3, 100)
+	w.External = &External{Fraction: 0, Size: 500, Divergence: 5000}
+	w.Seed(1)
+	if err := w.Backtrace(); err != nil {
+		t.Fatal(err)
+	}
+	for i, n := range w.GetHistory().Tree {
+		if n.Deme != 0 {
+			t.Fatalf("expected no ghost lineages without external transfers, but node %d is in deme %d", i, n.Deme)
+		}
+	}
+}
+
+func TestExternalValidate(t *testing.T) {
+	for _, e := range []External{{Fraction: 2, Size: 1}, {Fraction: 0.5}, {Fraction: 0.5, Size: 1, Divergence: -1}} {
+		if err := e.Validate(); err == nil {
+			t.Errorf("expected an error for %+v", e)
+		}
+		w := NewWFPopulation(1000, 10, 1000, 1e-4, 5e-3, 100)
+		w.External = &e
+		if err := w.Backtrace(); err == nil || len(w.GetHistory().Events) != 0 {
+			t.Errorf("expected Backtrace to return an error for %+v before any event", e)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package coals
+
+import (
+	"bytes"
+	"testing"
+)
+
+// without mutations, the sampled sequences should be copies of the ancestral one,
+// including the last site of every transferred fragment.
+func TestFortraceTransferredSites(t *testing.T) {
+	sample, length := 10, 200
+	w := NewWFPopulation(100, sample, length, 0, 5e-2, 20)
+	w.Seed(1)
+	if err := w.Backtrace(); err != nil {
+		t.Fatal(err)
+	}
+	seqMap := w.Fortrace()
+	for i := 0; i < sample; i++ {
+		if !bytes.Equal(seqMap[i], w.Ancestral()) {
+			t.Errorf("sequence of sample %d differs from the ancestral sequence", i)
+		}
+	}
+}
+
+// a seed should give the same sequences.
+func TestFortraceSeed(t *testing.T) {
+	sample, length := 10, 200
+	simulate := func() map[int][]byte {
+		w := NewWFPopulation(100, sample, length, 1e-3, 1e-2, 20)
+		w.Seed(1)
+		if err := w.Backtrace(); err != nil {
+			t.Fatal(err)
+		}
+		return w.Fortrace()
+	}
+	a, b := simulate(), simulate()
+	for i := 0; i < sample; i++ {
+		if !bytes.Equal(a[i], b[i]) {
+			t.Errorf("sequence of sample %d differs between two runs with the same seed", i)
+		}
+	}
+}
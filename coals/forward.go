@@ -2,64 +2,216 @@ package coals
 
 import (
 	"bitbucket.org/mingzhi/gsl/randist"
+	"fmt"
+	"sort"
 )
 
 const (
 	NucleicAcids = "ATGC"
 )
 
+// Mutation: a mutation placed by Fortrace on the branch above a tree node.
+type Mutation struct {
+	Node     int     // tree node below the mutation
+	Position int     // position in the genome
+	State    byte    // derived state
+	Time     float64 // absolute time, between the times of the node and its parent
+}
+
+// Fortrace drops mutations on the branches of the history and returns the sequences of the sampled genomes.
+// A branch runs from a node up to the event ending its lineage,
+// and gets Poisson(MutationRate * Size * length * m) mutations, for its length in time
+// and the m sites of ancestral material it carries up, placed uniformly on the material and in time.
+// Sequences are passed down from the ancestral sequence, a node inheriting from each parent
+// the material they share, and from the ancestral sequence the material no parent carries.
 func (w *WFPopulation) Fortrace() (seqMap map[int][]byte) {
-	seqMap = make(map[int][]byte)
-	for ei := len(w.history.Events) - 1; ei >= 0; ei-- {
-		event := w.history.Events[ei]
-		if event.Type == CoalescenceEvent {
-			a := event.Participants[0] // just one participant, the ancestor
-			seq, yes := seqMap[a]
-			if !yes {
-				seq = randomGenerateSequence(w.GenomeLength, w.rng)
+	return w.fortrace(nil)
+}
+
+// FortraceSegregating drops exactly segregating mutations on the branches of the history,
+// conditioning on the number of segregating sites instead of the mutation rate, as ms -s does,
+// and returns the sequences of the sampled genomes and the realized theta = 2 * Size * u per site,
+// the rate u whose expected number of mutations is segregating.
+// Each mutation falls on a site and a branch carrying it in proportion to the length of the branch,
+// at a site not mutated yet, so that every mutation makes a segregating site.
+// It panics if segregating is more than the genome length.
+func (w *WFPopulation) FortraceSegregating(segregating int) (seqMap map[int][]byte, theta float64) {
+	if segregating < 0 || segregating > w.GenomeLength {
+		panic(fmt.Sprintf("coals: cannot place %d segregating sites on a genome of %d sites", segregating, w.GenomeLength))
+	}
+	mutations, total := w.placeMutations(segregating)
+	seqMap = w.fortrace(mutations)
+	if total > 0 {
+		theta = 2.0 * float64(segregating) / total
+	}
+	return
+}
+
+// drop mutations and pass down the sequences, drawing the mutations of each branch
+// or taking them from placed if not nil.
+func (w *WFPopulation) fortrace(placed map[int][]Mutation) (seqMap map[int][]byte) {
+	h := w.history
+	w.mutations = nil
+	w.ancestral = randomGenerateSequence(w.GenomeLength, w.rng)
+
+	seqs := make(map[int][]byte)
+	sequence := func(n int) []byte {
+		seq, yes := seqs[n]
+		if !yes {
+			// a root
+			seq = make([]byte, w.GenomeLength)
+			copy(seq, w.ancestral)
+			seqs[n] = seq
+		}
+		return seq
+	}
+
+	for ei := len(h.Events) - 1; ei >= 0; ei-- {
+		event := h.Events[ei]
+		// nodes whose lineages end at the event
+		children := []int{}
+		for _, p := range event.Participants {
+			for _, c := range h.Tree[p].Children {
+				if len(children) == 0 || children[len(children)-1] != c {
+					children = append(children, c)
+				}
 			}
-			b := w.history.Tree[a].Children[0]
-			c := w.history.Tree[a].Children[1]
-			seqB := make([]byte, w.GenomeLength)
-			seqC := make([]byte, w.GenomeLength)
-			copy(seqB, seq)
-			copy(seqC, seq)
-			delete(seqMap, a)
-			seqMap[b] = seqB
-			seqMap[c] = seqC
-		} else {
-			seqC := make([]byte, w.GenomeLength)
-			for _, a := range event.Participants {
-				seqA := seqMap[a]
-				for _, frag := range w.history.Tree[a].Genome {
-					copy(seqC[frag.Begin:frag.End], seqA[frag.Begin:frag.End])
+		}
+
+		for _, c := range children {
+			seq := make([]byte, w.GenomeLength)
+			copy(seq, w.ancestral)
+			for _, p := range h.Tree[c].Parents {
+				seqP := sequence(p)
+				for _, frag := range Intersect(h.Tree[p].Genome, h.Tree[c].Genome) {
+					copy(seq[frag.Begin:frag.End+1], seqP[frag.Begin:frag.End+1])
 				}
-				delete(seqMap, a)
 			}
-			c := w.history.Tree[event.Participants[0]].Children[0]
-			seqMap[c] = seqC
+			if placed != nil {
+				w.applyMutations(placed[c], seq)
+			} else {
+				w.mutateBranch(c, seq)
+			}
+			seqs[c] = seq
+		}
+		for _, p := range event.Participants {
+			delete(seqs, p)
 		}
-		lambda := event.Time * w.MutationRate * float64(w.Size) * float64(w.GenomeLength)
-		mutateAll(seqMap, lambda, w.GenomeLength, w.rng)
 	}
 
+	seqMap = make(map[int][]byte)
+	for i := 0; i < w.SampleSize; i++ {
+		seqMap[i] = sequence(i)
+	}
 	return
 }
 
-func mutateAll(seqMap map[int][]byte, lambda float64, l int, rng *randist.RNG) {
-	for _, seq := range seqMap {
-		count := randist.PoissonRandomInt(rng, lambda)
-		for i := 0; i < count; i++ {
-			idx := randist.UniformRandomInt(rng, l)
-			a := NucleicAcids[randist.UniformRandomInt(rng, len(NucleicAcids))]
-			for a == seq[idx] {
-				a = NucleicAcids[randist.UniformRandomInt(rng, len(NucleicAcids))]
-			}
-			seq[idx] = a
+// Mutations returns the mutations placed by the last Fortrace.
+func (w *WFPopulation) Mutations() []Mutation {
+	return w.mutations
+}
+
+// the branch above a node, from its time to the time of its parents,
+// and the material carried up the branch, inherited by the parents, of material sites.
+func (w *WFPopulation) branch(n int) (begin, end float64, carried Assembly, material int) {
+	node := w.history.Tree[n]
+	begin = node.Time
+	end = w.history.Tree[node.Parents[0]].Time
+	for _, p := range node.Parents {
+		carried = Merge(carried, Intersect(w.history.Tree[p].Genome, node.Genome))
+	}
+	for _, frag := range carried {
+		material += frag.End - frag.Begin + 1
+	}
+	return
+}
+
+// the k-th site of the material.
+func siteOf(carried Assembly, k int) int {
+	for _, frag := range carried {
+		if k <= frag.End-frag.Begin {
+			return frag.Begin + k
 		}
+		k -= frag.End - frag.Begin + 1
+	}
+	panic("coals: site out of the material")
+}
+
+// mutate the sequence of a node along the branch above it, older mutations first.
+func (w *WFPopulation) mutateBranch(n int, seq []byte) {
+	begin, end, carried, material := w.branch(n)
+	lambda := (end - begin) * w.MutationRate * float64(w.Size) * float64(material)
+	count := randist.PoissonRandomInt(w.rng, lambda)
+	mutations := make([]Mutation, count)
+	for i := range mutations {
+		mutations[i].Node = n
+		mutations[i].Position = siteOf(carried, randist.UniformRandomInt(w.rng, material))
+		mutations[i].Time = begin + (end-begin)*randist.UniformRandomFloat64(w.rng)
+	}
+	w.applyMutations(mutations, seq)
+}
+
+// change the sequence of a node by the mutations of the branch above it, older mutations first.
+func (w *WFPopulation) applyMutations(mutations []Mutation, seq []byte) {
+	var model SubstitutionModel = JukesCantor{}
+	if w.Model != nil {
+		model = w.Model
+	}
+	sort.Slice(mutations, func(i, j int) bool { return mutations[i].Time > mutations[j].Time })
+	for _, m := range mutations {
+		m.State = model.Mutate(seq[m.Position], w.rng)
+		seq[m.Position] = m.State
+		w.mutations = append(w.mutations, m)
 	}
 }
 
+// place count mutations at distinct sites, by the nodes below them,
+// and return the total length of the branches times the sites they carry, in units of Size generations.
+// A mutation is drawn on a branch in proportion to its length times its material,
+// and again if its site is mutated already, so that a site is chosen in proportion to its tree length.
+func (w *WFPopulation) placeMutations(count int) (placed map[int][]Mutation, total float64) {
+	h := w.history
+	type branch struct {
+		node       int
+		begin, end float64
+		carried    Assembly
+		material   int
+	}
+	branches := []branch{}
+	cumulative := []float64{}
+	for n := range h.Tree {
+		if len(h.Tree[n].Parents) == 0 {
+			continue
+		}
+		b := branch{node: n}
+		b.begin, b.end, b.carried, b.material = w.branch(n)
+		if b.material == 0 || b.end <= b.begin {
+			continue
+		}
+		total += (b.end - b.begin) * float64(b.material)
+		branches = append(branches, b)
+		cumulative = append(cumulative, total)
+	}
+	if count > 0 && total == 0 {
+		panic("coals: no branch to place mutations on")
+	}
+
+	placed = make(map[int][]Mutation)
+	mutated := make(map[int]bool)
+	for len(mutated) < count {
+		x := randist.UniformRandomFloat64(w.rng) * total
+		b := branches[sort.SearchFloat64s(cumulative, x)]
+		site := siteOf(b.carried, randist.UniformRandomInt(w.rng, b.material))
+		if mutated[site] {
+			continue
+		}
+		mutated[site] = true
+		m := Mutation{Node: b.node, Position: site, Time: b.begin + (b.end-b.begin)*randist.UniformRandomFloat64(w.rng)}
+		placed[b.node] = append(placed[b.node], m)
+	}
+	return
+}
+
 func randomGenerateSequence(length int, rng *randist.RNG) (seq []byte) {
 	seq = make([]byte, length)
 	for i, _ := range seq {
@@ -0,0 +1,125 @@
+package coals
+
+import (
+	"github.com/mingzhi/hgt/simtest"
+	"math"
+	"testing"
+)
+
+// mutations stay on the ancestral material of their branches,
+// and the mean pairwise difference per site is theta / (1 + 4/3 theta), theta = 2 * N * u,
+// under the Jukes-Cantor model.
+func TestFortrace(t *testing.T) {
+	size, sample, length, mutation := 1000, 10, 1000, 1e-5
+	replicates := 200
+	if testing.Short() {
+		replicates = 50
+	}
+	w := NewWFPopulation(size, sample, length, mutation, 1e-4, 100)
+	pi := simtest.Replicate(replicates, simtest.Seed(t), func(seed int) float64 {
+		w.Seed(seed)
+		w.history = NewEvolutionHistory(sample, length)
+		if err := w.Backtrace(); err != nil {
+			t.Fatal(err)
+		}
+		seqs := w.Fortrace()
+		for _, m := range w.Mutations() {
+			if !w.history.Tree[m.Node].carries(m.Position) {
+				t.Fatalf("mutation %v is off the ancestral material of its node", m)
+			}
+		}
+		return diversity(seqs, sample, length)
+	})
+
+	f := simtest.NewFamily(t, 1e-3)
+	f.Mean("pairwise differences per site", pi, jukesCantorDiversity(2.0*float64(size)*mutation))
+	f.Check()
+}
+
+// the mean pairwise difference per site of the sampled sequences.
+func diversity(seqs map[int][]byte, sample, length int) float64 {
+	diffs, pairs := 0, 0
+	for i := 0; i < sample; i++ {
+		for j := i + 1; j < sample; j++ {
+			for k := 0; k < length; k++ {
+				if seqs[i][k] != seqs[j][k] {
+					diffs++
+				}
+			}
+			pairs++
+		}
+	}
+	return float64(diffs) / float64(pairs*length)
+}
+
+// the expected pairwise difference per site of two genomes coalescing in Exp(1) time
+// with theta = 2 * N * u, under the Jukes-Cantor model.
+func jukesCantorDiversity(theta float64) float64 {
+	return theta / (1 + 4.0/3.0*theta)
+}
+
+// every placed mutation makes a segregating site, and the realized theta makes them expected.
+func TestFortraceSegregating(t *testing.T) {
+	sample, length, segregating := 10, 1000, 50
+	w := NewWFPopulation(1000, sample, length, 1e-5, 1e-2, 100)
+	w.Seed(simtest.Seed(t))
+	if err := w.Backtrace(); err != nil {
+		t.Fatal(err)
+	}
+	seqs, theta := w.FortraceSegregating(segregating)
+	if len(w.Mutations()) != segregating {
+		t.Errorf("expected %d mutations, but got %d", segregating, len(w.Mutations()))
+	}
+	sites := 0
+	for k := 0; k < length; k++ {
+		for i := 1; i < sample; i++ {
+			if seqs[i][k] != seqs[0][k] {
+				sites++
+				break
+			}
+		}
+	}
+	if sites != segregating {
+		t.Errorf("expected %d segregating sites, but got %d", segregating, sites)
+	}
+	if _, total := w.placeMutations(0); math.Abs(theta*total/2-float64(segregating)) > 1e-9 {
+		t.Errorf("expected theta %g to give %d mutations over the branches, but got %g", theta, segregating, theta*total/2)
+	}
+}
+
+// a single mutation falls on a branch in proportion to its length.
+func TestPlaceMutations(t *testing.T) {
+	w := NewWFPopulation(1000, 6, 100, 1e-4, 0, 10)
+	w.Seed(simtest.Seed(t))
+	if err := w.Backtrace(); err != nil {
+		t.Fatal(err)
+	}
+	h := w.GetHistory()
+	expected := make([]float64, len(h.Tree))
+	total := 0.0
+	for n, node := range h.Tree {
+		if len(node.Parents) > 0 {
+			expected[n] = h.Tree[node.Parents[0]].Time - node.Time
+			total += expected[n]
+		}
+	}
+
+	draws := 5000
+	observed := make([]float64, len(h.Tree))
+	for i := 0; i < draws; i++ {
+		placed, _ := w.placeMutations(1)
+		for n := range placed {
+			observed[n]++
+		}
+	}
+	obs, exp := []float64{}, []float64{}
+	for n := range expected {
+		if expected[n] > 0 {
+			obs = append(obs, observed[n])
+			exp = append(exp, expected[n]/total*float64(draws))
+		}
+	}
+	f := simtest.NewFamily(t, 1e-3)
+	f.ChiSquare("mutations by branch", obs, exp)
+	f.Check()
+}
@@ -0,0 +1,101 @@
+package coals
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// names of tree node types
+const (
+	sampleNode      = "sample"
+	coalescenceNode = "coalescence"
+	transferNode    = "transfer"
+	migrationNode   = "migration"
+)
+
+// type of each tree node: a sample leaf, or the type of the event creating it.
+func (h *EvolutionHistory) nodeTypes() []string {
+	types := make([]string, len(h.Tree))
+	for i := range types {
+		types[i] = sampleNode
+	}
+	for _, event := range h.Events {
+		for _, p := range event.Participants {
+			switch event.Type {
+			case CoalescenceEvent:
+				types[p] = coalescenceNode
+			case MigrationEvent:
+				types[p] = migrationNode
+			default:
+				types[p] = transferNode
+			}
+		}
+	}
+	return types
+}
+
+// an edge from a parent to a child, with the ancestral material passed along it.
+type graphEdge struct {
+	parent, child int
+	material      Assembly
+}
+
+func (h *EvolutionHistory) edges() (edges []graphEdge) {
+	for p, node := range h.Tree {
+		for _, c := range node.Children {
+			edges = append(edges, graphEdge{p, c, Intersect(node.Genome, h.Tree[c].Genome)})
+		}
+	}
+	return
+}
+
+// WriteDot writes the history as a directed graph in DOT format.
+// Nodes carry their time, type and deme,
+// and edges from parents to children are labeled with the ancestral material they pass.
+func (h *EvolutionHistory) WriteDot(w io.Writer) error {
+	types := h.nodeTypes()
+	shapes := map[string]string{sampleNode: "box", coalescenceNode: "ellipse", transferNode: "diamond", migrationNode: "circle"}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph ARG {")
+	for i := range h.Tree {
+		fmt.Fprintf(bw, "\tn%d [label=\"%d\\nt=%.4g\", shape=%s, time=%g, type=%s, deme=%d];\n",
+			i, i, h.Tree[i].Time, shapes[types[i]], h.Tree[i].Time, types[i], h.Tree[i].Deme)
+	}
+	for _, e := range h.edges() {
+		fmt.Fprintf(bw, "\tn%d -> n%d [label=\"%s\"];\n", e.parent, e.child, e.material)
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// WriteGraphML writes the history as a directed graph in GraphML format,
+// with the same attributes as WriteDot.
+func (h *EvolutionHistory) WriteGraphML(w io.Writer) error {
+	types := h.nodeTypes()
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(bw, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(bw, `  <key id="time" for="node" attr.name="time" attr.type="double"/>`)
+	fmt.Fprintln(bw, `  <key id="type" for="node" attr.name="type" attr.type="string"/>`)
+	fmt.Fprintln(bw, `  <key id="deme" for="node" attr.name="deme" attr.type="int"/>`)
+	fmt.Fprintln(bw, `  <key id="material" for="edge" attr.name="material" attr.type="string"/>`)
+	fmt.Fprintln(bw, `  <graph id="ARG" edgedefault="directed">`)
+	for i := range h.Tree {
+		fmt.Fprintf(bw, "    <node id=\"n%d\">\n", i)
+		fmt.Fprintf(bw, "      <data key=\"time\">%g</data>\n", h.Tree[i].Time)
+		fmt.Fprintf(bw, "      <data key=\"type\">%s</data>\n", types[i])
+		fmt.Fprintf(bw, "      <data key=\"deme\">%d</data>\n", h.Tree[i].Deme)
+		fmt.Fprintln(bw, "    </node>")
+	}
+	for _, e := range h.edges() {
+		fmt.Fprintf(bw, "    <edge source=\"n%d\" target=\"n%d\">\n", e.parent, e.child)
+		fmt.Fprintf(bw, "      <data key=\"material\">%s</data>\n", e.material)
+		fmt.Fprintln(bw, "    </edge>")
+	}
+	fmt.Fprintln(bw, "  </graph>")
+	fmt.Fprintln(bw, "</graphml>")
+	return bw.Flush()
+}
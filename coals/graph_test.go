@@ -0,0 +1,59 @@
+package coals
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestIntersect(t *testing.T) {
+	a := Assembly{Fragment{Begin: 0, End: 10}, Fragment{Begin: 20, End: 30}}
+	b := Assembly{Fragment{Begin: 25, End: 40}, Fragment{Begin: 5, End: 22}}
+	c := Intersect(a, b)
+	if c.String() != "[5,10] [20,22] [25,30]" {
+		t.Errorf("unexpected intersection %s", c)
+	}
+}
+
+func TestWriteDot(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testHistory().WriteDot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+	for _, line := range []string{
+		`n4 [label="4\nt=1", shape=diamond, time=1, type=transfer, deme=0];`,
+		`n7 [label="7\nt=3.5", shape=ellipse, time=3.5, type=coalescence, deme=0];`,
+		`n0 [label="0\nt=0", shape=box, time=0, type=sample, deme=0];`,
+		`n3 -> n2 [label="[0,2] [6,9]"];`,
+		`n6 -> n4 [label="[3,5]"];`,
+	} {
+		if !strings.Contains(dot, line) {
+			t.Errorf("expected %s in\n%s", line, dot)
+		}
+	}
+}
+
+func TestWriteGraphML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testHistory().WriteGraphML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var graphml struct {
+		Nodes []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"graph>node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+			Target string `xml:"target,attr"`
+			Data   string `xml:"data"`
+		} `xml:"graph>edge"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &graphml); err != nil {
+		t.Fatal(err)
+	}
+	if len(graphml.Nodes) != 8 || len(graphml.Edges) != 8 {
+		t.Errorf("expected 8 nodes and 8 edges, but got %d and %d", len(graphml.Nodes), len(graphml.Edges))
+	}
+}
@@ -0,0 +1,70 @@
+package coals
+
+import (
+	"bitbucket.org/mingzhi/gsl/randist"
+	"fmt"
+	"strings"
+)
+
+// SubstitutionModel: how a mutation changes a nucleotide of NucleicAcids.
+// Both models have equal base frequencies, so the root sequence is uniformly random.
+type SubstitutionModel interface {
+	Mutate(a byte, rng *randist.RNG) byte // a nucleotide different from a
+	Name() string
+}
+
+// JukesCantor: all changes are equally likely.
+type JukesCantor struct{}
+
+func (m JukesCantor) Mutate(a byte, rng *randist.RNG) byte {
+	b := NucleicAcids[randist.UniformRandomInt(rng, len(NucleicAcids))]
+	for b == a {
+		b = NucleicAcids[randist.UniformRandomInt(rng, len(NucleicAcids))]
+	}
+	return b
+}
+
+func (m JukesCantor) Name() string {
+	return "jc"
+}
+
+// Kimura: the two-parameter model of Kimura (1980, K80),
+// where transitions (A <-> G, C <-> T) are Kappa times as likely as each transversion.
+type Kimura struct {
+	Kappa float64 // ratio of the transition rate to the transversion rate
+}
+
+func (m Kimura) Mutate(a byte, rng *randist.RNG) byte {
+	transitions := map[byte]byte{'A': 'G', 'G': 'A', 'C': 'T', 'T': 'C'}
+	if randist.UniformRandomFloat64(rng) < m.Kappa/(m.Kappa+2.0) {
+		return transitions[a]
+	}
+	// one of the two transversions
+	transversions := []byte{}
+	for i := 0; i < len(NucleicAcids); i++ {
+		b := NucleicAcids[i]
+		if b != a && b != transitions[a] {
+			transversions = append(transversions, b)
+		}
+	}
+	return transversions[randist.UniformRandomInt(rng, len(transversions))]
+}
+
+func (m Kimura) Name() string {
+	return "k80"
+}
+
+// ParseSubstitutionModel returns the model of a name, "jc" or "k80",
+// kappa being the transition/transversion ratio of K80.
+func ParseSubstitutionModel(name string, kappa float64) (SubstitutionModel, error) {
+	switch strings.ToLower(name) {
+	case "jc", "jc69":
+		return JukesCantor{}, nil
+	case "k80", "k2p":
+		if kappa <= 0 {
+			return nil, fmt.Errorf("kappa of K80 should be positive, got %g", kappa)
+		}
+		return Kimura{Kappa: kappa}, nil
+	}
+	return nil, fmt.Errorf("unknown substitution model: %s", name)
+}
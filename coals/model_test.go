@@ -0,0 +1,44 @@
+package coals
+
+import (
+	"bitbucket.org/mingzhi/gsl/randist"
+	"testing"
+)
+
+func TestSubstitutionModels(t *testing.T) {
+	rng := randist.NewRNG(randist.MT19937)
+	rng.SetSeed(1)
+	transition := map[byte]byte{'A': 'G', 'G': 'A', 'C': 'T', 'T': 'C'}
+	n := 100000
+	for _, kappa := range []float64{1, 4} {
+		m, err := ParseSubstitutionModel("k80", kappa)
+		if err != nil {
+			t.Fatal(err)
+		}
+		transitions := 0
+		for i := 0; i < n; i++ {
+			a := NucleicAcids[i%len(NucleicAcids)]
+			b := m.Mutate(a, rng)
+			if b == a {
+				t.Fatalf("%s mutated %c into itself", m.Name(), a)
+			}
+			if b == transition[a] {
+				transitions++
+			}
+		}
+		expected := kappa / (kappa + 2)
+		if f := float64(transitions) / float64(n); f < expected-0.01 || f > expected+0.01 {
+			t.Errorf("kappa %g: expected transition fraction %g, but got %g", kappa, expected, f)
+		}
+	}
+
+	jc := JukesCantor{}
+	for i := 0; i < 100; i++ {
+		if jc.Mutate('A', rng) == 'A' {
+			t.Fatal("jc mutated A into itself")
+		}
+	}
+	if _, err := ParseSubstitutionModel("gtr", 1); err == nil {
+		t.Error("expected an error for an unknown model")
+	}
+}
@@ -0,0 +1,233 @@
+package coals
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Reference population size used to convert scaled ms parameters into rates.
+// Only the products of the size and the rates matter to the coalescent.
+const MSPopulationSize = 10000
+
+// Number of sites of the locus without -r.
+// ms assumes infinite sites, which a long locus approximates:
+// the mutation rate per site is then small enough for sites to rarely mutate twice.
+const MSSites = 100000
+
+// MSParams: parameters of an ms command line,
+// "ms nsam nreps -t theta [-s segsites] [-r rho nsites -c f lambda] [-seeds x1 x2 x3]".
+// The model only has transfer (gene conversion), not crossing over:
+// transfers occur at the scaled rate f * rho with the tract length lambda,
+// and -r without -c is rejected.
+// With -s, each replicate has exactly segsites segregating sites, and -t is optional;
+// the sites are finite, so nsites should be at least segsites.
+// Without -r, the locus has MSSites sites.
+type MSParams struct {
+	SampleSize  int     // nsam
+	Replicates  int     // nreps
+	Theta       float64 // scaled mutation rate of the locus, 2 * N * u * L
+	Segsites    int     // fixed number of segregating sites, if positive
+	Rho         float64 // scaled recombination rate of the locus
+	Sites       int     // number of sites
+	Conversion  float64 // ratio of gene conversion to crossing over
+	TractLength int     // mean tract length of gene conversion, used as transfer length
+	Seeds       []int   // random seeds, all combined into the seed of the simulation
+	Args        []string
+}
+
+// ParseMSArgs parses ms arguments (without the program name).
+func ParseMSArgs(args []string) (*MSParams, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("ms: expected nsam and nreps")
+	}
+	p := MSParams{Sites: MSSites, Args: args}
+	var err error
+	if p.SampleSize, err = strconv.Atoi(args[0]); err != nil || p.SampleSize < 2 {
+		return nil, fmt.Errorf("ms: invalid nsam %q", args[0])
+	}
+	if p.Replicates, err = strconv.Atoi(args[1]); err != nil || p.Replicates < 1 {
+		return nil, fmt.Errorf("ms: invalid nreps %q", args[1])
+	}
+
+	hasRho, hasConversion := false, false
+	for i := 2; i < len(args); i++ {
+		// values following option args[i]
+		values := func(n int) ([]float64, error) {
+			if i+n >= len(args) {
+				return nil, fmt.Errorf("ms: option %s expects %d values", args[i], n)
+			}
+			vs := make([]float64, n)
+			for j := range vs {
+				v, err := strconv.ParseFloat(args[i+1+j], 64)
+				if err != nil {
+					return nil, fmt.Errorf("ms: invalid value %q of option %s", args[i+1+j], args[i])
+				}
+				vs[j] = v
+			}
+			i += n
+			return vs, nil
+		}
+
+		switch args[i] {
+		case "-t":
+			vs, err := values(1)
+			if err != nil {
+				return nil, err
+			}
+			p.Theta = vs[0]
+		case "-s":
+			vs, err := values(1)
+			if err != nil {
+				return nil, err
+			}
+			p.Segsites = int(vs[0])
+		case "-r":
+			vs, err := values(2)
+			if err != nil {
+				return nil, err
+			}
+			p.Rho, p.Sites = vs[0], int(vs[1])
+			hasRho = true
+		case "-c":
+			vs, err := values(2)
+			if err != nil {
+				return nil, err
+			}
+			p.Conversion, p.TractLength = vs[0], int(vs[1])
+			hasConversion = true
+		case "-seeds":
+			vs, err := values(3)
+			if err != nil {
+				return nil, err
+			}
+			p.Seeds = []int{int(vs[0]), int(vs[1]), int(vs[2])}
+		default:
+			return nil, fmt.Errorf("ms: unsupported option %s", args[i])
+		}
+	}
+
+	if p.Theta <= 0 && p.Segsites <= 0 {
+		return nil, fmt.Errorf("ms: -t theta or -s segsites is required")
+	}
+	if hasRho && !hasConversion && p.Rho > 0 {
+		return nil, fmt.Errorf("ms: crossing over is not supported, use -c f lambda for transfer")
+	}
+	if hasConversion && p.TractLength <= 0 {
+		return nil, fmt.Errorf("ms: tract length should be positive")
+	}
+	if p.Sites < 1 {
+		return nil, fmt.Errorf("ms: nsites should be positive")
+	}
+	if p.Segsites > p.Sites {
+		return nil, fmt.Errorf("ms: %d segregating sites do not fit into %d sites, set nsites with -r", p.Segsites, p.Sites)
+	}
+
+	return &p, nil
+}
+
+// NewWFPopulation returns a population simulating the ms parameters,
+// with MSPopulationSize as its size.
+// The seeds are combined into one seed, so that changing any of them changes the simulation.
+func (p *MSParams) NewWFPopulation() *WFPopulation {
+	n := float64(MSPopulationSize)
+	mutation := p.Theta / (2.0 * n * float64(p.Sites))
+	transfer := p.Conversion * p.Rho / (2.0 * n)
+	w := NewWFPopulation(MSPopulationSize, p.SampleSize, p.Sites, mutation, transfer, p.TractLength)
+	if len(p.Seeds) > 0 {
+		seed := 0
+		for _, s := range p.Seeds {
+			seed = seed*1000003 + s
+		}
+		w.Seed(seed)
+	}
+	return w
+}
+
+// WriteMSHeader writes the command line and the seeds, which start an ms output.
+func WriteMSHeader(w io.Writer, p *MSParams) error {
+	seeds := make([]string, len(p.Seeds))
+	for i, s := range p.Seeds {
+		seeds[i] = strconv.Itoa(s)
+	}
+	_, err := fmt.Fprintf(w, "ms %s\n%s\n", strings.Join(p.Args, " "), strings.Join(seeds, " "))
+	return err
+}
+
+// WriteMS writes a replicate of sequences in ms format.
+// Alleles equal to the ancestral sequence are 0, others are 1;
+// if ancestral is nil, the allele of the first sequence is 0.
+// Positions are (k + 0.5) / L for a site k of a genome of length L.
+func WriteMS(w io.Writer, seqs [][]byte, ancestral []byte) error {
+	if len(seqs) > 0 && ancestral == nil {
+		ancestral = seqs[0]
+	}
+
+	// find segregating sites
+	sites := []int{}
+	for k := 0; k < len(ancestral); k++ {
+		for _, seq := range seqs {
+			if seq[k] != seqs[0][k] {
+				sites = append(sites, k)
+				break
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "\n//\nsegsites: %d\n", len(sites))
+	if len(sites) > 0 {
+		// enough digits to distinguish sites
+		digits := int(math.Max(4, math.Ceil(math.Log10(float64(len(ancestral))))+1))
+		fmt.Fprint(bw, "positions:")
+		for _, k := range sites {
+			fmt.Fprintf(bw, " %.*f", digits, (float64(k)+0.5)/float64(len(ancestral)))
+		}
+		fmt.Fprintln(bw)
+		for _, seq := range seqs {
+			line := make([]byte, len(sites))
+			for i, k := range sites {
+				if seq[k] == ancestral[k] {
+					line[i] = '0'
+				} else {
+					line[i] = '1'
+				}
+			}
+			bw.Write(line)
+			bw.WriteString("\n")
+		}
+	}
+
+	return bw.Flush()
+}
+
+// MS runs all replicates of the ms parameters and writes them in ms format.
+func MS(w io.Writer, p *MSParams) error {
+	if err := WriteMSHeader(w, p); err != nil {
+		return err
+	}
+	pop := p.NewWFPopulation()
+	for r := 0; r < p.Replicates; r++ {
+		pop.history = NewEvolutionHistory(p.SampleSize, p.Sites)
+		if err := pop.Backtrace(); err != nil {
+			return err
+		}
+		var seqMap map[int][]byte
+		if p.Segsites > 0 {
+			seqMap, _ = pop.FortraceSegregating(p.Segsites)
+		} else {
+			seqMap = pop.Fortrace()
+		}
+		seqs := make([][]byte, p.SampleSize)
+		for i := range seqs {
+			seqs[i] = seqMap[i]
+		}
+		if err := WriteMS(w, seqs, pop.Ancestral()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
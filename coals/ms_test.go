@@ -0,0 +1,134 @@
+package coals
+
+import (
+	"bytes"
+	"github.com/mingzhi/hgt/simtest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseMSArgs(t *testing.T) {
+	p, err := ParseMSArgs(strings.Fields("20 5 -t 10 -r 4 1000 -c 2 100 -seeds 1 2 3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SampleSize != 20 || p.Replicates != 5 || p.Theta != 10 || p.Sites != 1000 || p.TractLength != 100 {
+		t.Errorf("unexpected parameters %+v", p)
+	}
+
+	w := p.NewWFPopulation()
+	if theta := 2.0 * float64(w.Size) * w.MutationRate * float64(w.GenomeLength); theta < 10-1e-9 || theta > 10+1e-9 {
+		t.Errorf("expected theta 10, but got %g", theta)
+	}
+	if rho := 2.0 * float64(w.Size) * w.TransferRate; rho < 8-1e-9 || rho > 8+1e-9 {
+		t.Errorf("expected transfer rate 8, but got %g", rho)
+	}
+
+	for _, args := range []string{"20", "20 5", "20 5 -t 1 -r 4 1000", "20 5 -t 1 -x", "20 5 -t"} {
+		if _, err := ParseMSArgs(strings.Fields(args)); err == nil {
+			t.Errorf("expected an error for %q", args)
+		}
+	}
+}
+
+func TestWriteMS(t *testing.T) {
+	seqs := [][]byte{[]byte("AAAA"), []byte("ATAA"), []byte("ATAC")}
+	var buf bytes.Buffer
+	if err := WriteMS(&buf, seqs, []byte("AAAC")); err != nil {
+		t.Fatal(err)
+	}
+	expected := "\n//\nsegsites: 2\npositions: 0.3750 0.8750\n01\n11\n10\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, but got %q", expected, buf.String())
+	}
+}
+
+func TestMS(t *testing.T) {
+	p, err := ParseMSArgs(strings.Fields("5 3 -t 5 -r 2 500 -c 1 50 -seeds 1 2 3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := MS(&buf, p); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "//"); n != 3 {
+		t.Errorf("expected 3 replicates, but got %d", n)
+	}
+}
+
+func TestMSSegsites(t *testing.T) {
+	p, err := ParseMSArgs(strings.Fields("5 3 -s 7 -r 2 500 -c 1 50 -seeds 1 2 3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := MS(&buf, p); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "segsites: 7\n"); n != 3 {
+		t.Errorf("expected 3 replicates of 7 segregating sites, but got %d in %s", n, buf.String())
+	}
+	if _, err := ParseMSArgs(strings.Fields("5 3 -s 7 -r 0 5")); err == nil {
+		t.Error("expected an error for more segregating sites than sites")
+	}
+}
+
+func TestMSInfiniteSites(t *testing.T) {
+	// without -r, the locus approximates infinite sites,
+	// so the expected number of segregating sites is theta * a(n),
+	// with a(n) = sum 1/i for i < n.
+	reps := 200
+	if testing.Short() {
+		reps = 50
+	}
+	p, err := ParseMSArgs(strings.Fields("5 " + strconv.Itoa(reps) + " -t 5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Seeds = []int{simtest.Seed(t), 0, 0}
+	var buf bytes.Buffer
+	if err := MS(&buf, p); err != nil {
+		t.Fatal(err)
+	}
+
+	segsites := []float64{}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "segsites: ") {
+			s, err := strconv.Atoi(strings.TrimPrefix(line, "segsites: "))
+			if err != nil {
+				t.Fatal(err)
+			}
+			segsites = append(segsites, float64(s))
+		}
+	}
+	an := 1.0 + 1.0/2 + 1.0/3 + 1.0/4
+	f := simtest.NewFamily(t, 1e-3)
+	f.Mean("segregating sites", segsites, 5*an)
+	f.Check()
+}
+
+func TestMSSeeds(t *testing.T) {
+	// every seed changes the simulation.
+	run := func(seeds string) string {
+		p, err := ParseMSArgs(strings.Fields("5 1 -t 5 -seeds " + seeds))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := MS(&buf, p); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()[strings.Index(buf.String(), "//"):]
+	}
+	a := run("1 2 3")
+	if a != run("1 2 3") {
+		t.Error("the same seeds gave different simulations")
+	}
+	for _, seeds := range []string{"4 2 3", "1 4 3", "1 2 4"} {
+		if a == run(seeds) {
+			t.Errorf("seeds %s gave the same simulation as 1 2 3", seeds)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package coals
+
+// Backtrace keeps its lineages in CurrentPool, indexed by their positions,
+// so that a lineage is chosen at random by its position,
+// and removed in constant time by moving the last lineage into its place.
+//
+// A lineage carries up the ancestral material whose most recent common ancestor is not found yet.
+// Backtrace counts the lineages carrying each site, the sampled genomes still to enter the pool included,
+// and when a coalescence leaves a single lineage carrying a site,
+// the ancestor keeps the site in its Genome, shared with its children, but does not carry it up.
+// An ancestor carrying nothing up leaves the pool unless it is the last lineage,
+// so the history ends at the oldest most recent common ancestor of a site.
+
+// index the lineages of the pool by their positions.
+func (h *EvolutionHistory) indexPool() {
+	h.poolIndex = make(map[int]int, len(h.CurrentPool))
+	for i, c := range h.CurrentPool {
+		h.poolIndex[c] = i
+	}
+}
+
+// add a lineage into the pool.
+func (h *EvolutionHistory) addLineage(c int) {
+	if h.poolIndex == nil {
+		h.indexPool()
+	}
+	h.poolIndex[c] = len(h.CurrentPool)
+	h.CurrentPool = append(h.CurrentPool, c)
+}
+
+// remove a lineage from the pool, moving the last lineage into its place.
+func (h *EvolutionHistory) removeLineage(c int) {
+	if h.poolIndex == nil {
+		h.indexPool()
+	}
+	i, yes := h.poolIndex[c]
+	if !yes {
+		return
+	}
+	last := h.CurrentPool[len(h.CurrentPool)-1]
+	h.CurrentPool[i] = last
+	h.poolIndex[last] = i
+	h.CurrentPool = h.CurrentPool[:len(h.CurrentPool)-1]
+	delete(h.poolIndex, c)
+}
+
+// the ancestral material a lineage of the pool carries up.
+func (w *WFPopulation) material(c int) Assembly {
+	if a, yes := w.carried[c]; yes {
+		return a
+	}
+	return w.history.Tree[c].Genome
+}
+
+// segment: sites [Begin, End] carried by Count lineages.
+type segment struct {
+	Begin, End int
+	Count      int
+}
+
+// coverage: the numbers of lineages carrying the sites of the genome,
+// as sorted segments covering it, adjacent segments having different counts.
+type coverage []segment
+
+// count the lineages of the pool and the sampled genomes not yet in it.
+func (w *WFPopulation) countLineages() {
+	w.coverage = coverage{segment{Begin: 0, End: w.GenomeLength - 1}}
+	for _, c := range w.history.CurrentPool {
+		w.coverage.add(w.material(c), 1)
+	}
+	for _, c := range w.pending {
+		w.coverage.add(w.history.Tree[c].Genome, 1)
+	}
+}
+
+// add delta to the counts of the sites of the material.
+func (v *coverage) add(a Assembly, delta int) {
+	if len(a) == 0 {
+		return
+	}
+	a = sorted(a)
+	segs := coverage{}
+	j := 0
+	for _, s := range *v {
+		// pieces of s, inside and outside of the fragments
+		for s.Begin <= s.End {
+			for j < len(a) && a[j].End < s.Begin {
+				j++
+			}
+			if j == len(a) || a[j].Begin > s.End {
+				segs.push(s)
+				break
+			}
+			if a[j].Begin > s.Begin {
+				segs.push(segment{Begin: s.Begin, End: a[j].Begin - 1, Count: s.Count})
+				s.Begin = a[j].Begin
+			}
+			end := a[j].End
+			if end > s.End {
+				end = s.End
+			}
+			segs.push(segment{Begin: s.Begin, End: end, Count: s.Count + delta})
+			s.Begin = end + 1
+		}
+	}
+	*v = segs
+}
+
+// append a segment, joining it with the last one if they have the same count.
+func (v *coverage) push(s segment) {
+	if n := len(*v); n > 0 && (*v)[n-1].Count == s.Count && (*v)[n-1].End+1 == s.Begin {
+		(*v)[n-1].End = s.End
+		return
+	}
+	*v = append(*v, s)
+}
+
+// the sites of the material carried by a single lineage.
+func (v coverage) singles(a Assembly) Assembly {
+	single := Assembly{}
+	for _, s := range v {
+		if s.Count == 1 {
+			single = append(single, Fragment{Begin: s.Begin, End: s.End})
+		}
+	}
+	return Intersect(a, single)
+}
+
+// the material of a not in b.
+func difference(a, b Assembly) (c Assembly) {
+	a, b = sorted(a), sorted(b)
+	j := 0
+	for _, frag := range a {
+		begin := frag.Begin
+		for j < len(b) && b[j].End < begin {
+			j++
+		}
+		for k := j; k < len(b) && b[k].Begin <= frag.End; k++ {
+			if b[k].Begin > begin {
+				c = append(c, Fragment{Begin: begin, End: b[k].Begin - 1})
+			}
+			if b[k].End+1 > begin {
+				begin = b[k].End + 1
+			}
+		}
+		if begin <= frag.End {
+			c = append(c, Fragment{Begin: begin, End: frag.End})
+		}
+	}
+	return
+}
+
+// the material the ancestor of two coalescing lineages carries up,
+// without the sites whose most recent common ancestor it is, and whether there are such sites.
+func (w *WFPopulation) prune(a, b, genome Assembly) (Assembly, bool) {
+	if w.coverage == nil {
+		return genome, false
+	}
+	shared := Intersect(a, b)
+	w.coverage.add(shared, -1)
+	found := w.coverage.singles(shared)
+	if len(found) == 0 {
+		return genome, false
+	}
+	w.coverage.add(found, -1)
+	return difference(genome, found), true
+}
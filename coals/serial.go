@@ -0,0 +1,74 @@
+package coals
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// NewSerialSampleTimes returns the sampling times of groups of genomes,
+// sizes[i] genomes being sampled gens[i] generations ago,
+// in units of size generations as SampleTimes.
+func NewSerialSampleTimes(size int, gens []float64, sizes []int) ([]float64, error) {
+	if len(gens) != len(sizes) {
+		return nil, fmt.Errorf("coals: got %d sampling times for %d groups", len(gens), len(sizes))
+	}
+	times := []float64{}
+	for i, g := range gens {
+		if g < 0 {
+			return nil, fmt.Errorf("coals: sampling time should not be negative, got %g", g)
+		}
+		for j := 0; j < sizes[i]; j++ {
+			times = append(times, g/float64(size))
+		}
+	}
+	return times, nil
+}
+
+// set the current time, and if the history is new, the times of the sampled genomes,
+// keeping those sampled in the past out of the pool until Backtrace reaches them.
+func (w *WFPopulation) setSampleTimes() {
+	h := w.history
+	w.now = h.TMRCA()
+	w.pending = nil
+	if w.SampleTimes == nil || len(h.Events) > 0 {
+		return
+	}
+	pool := []int{}
+	for i, t := range w.SampleTimes {
+		h.Tree[i].Time = t
+		if t > 0 {
+			w.pending = append(w.pending, i)
+		} else {
+			pool = append(pool, i)
+		}
+	}
+	sort.SliceStable(w.pending, func(i, j int) bool { return h.Tree[w.pending[i]].Time < h.Tree[w.pending[j]].Time })
+	h.CurrentPool = pool
+}
+
+// advance the current time by the waiting time of the next event.
+// If a sampled genome enters the pool first, the time stops at its sampling time,
+// and the event does not happen, to be drawn again with the new pool.
+// Otherwise it returns the time of the event after the last event.
+func (w *WFPopulation) advance(wait float64) (float64, bool) {
+	h := w.history
+	if len(w.pending) > 0 && h.Tree[w.pending[0]].Time < w.now+wait {
+		w.now = h.Tree[w.pending[0]].Time
+		for len(w.pending) > 0 && h.Tree[w.pending[0]].Time <= w.now {
+			h.addLineage(w.pending[0])
+			w.pending = w.pending[1:]
+		}
+		return 0, false
+	}
+	if math.IsInf(wait, 1) {
+		panic("coals: no more events in Backtrace")
+	}
+	// time since the last event, exactly the waiting time unless samples entered since
+	since := wait
+	if last := h.TMRCA(); w.now != last {
+		since = w.now + wait - last
+	}
+	w.now += wait
+	return since, true
+}
@@ -0,0 +1,94 @@
+package coals
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mingzhi/hgt/simtest"
+	"testing"
+)
+
+func TestNewSerialSampleTimes(t *testing.T) {
+	times, err := NewSerialSampleTimes(1000, []float64{0, 500}, []int{2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != 3 || times[0] != 0 || times[2] != 0.5 {
+		t.Errorf("expected times [0 0 0.5], but got %v", times)
+	}
+	if _, err := NewSerialSampleTimes(1000, []float64{-1}, []int{2}); err == nil {
+		t.Error("expected an error for a negative time")
+	}
+}
+
+// a genome sampled at time 1 coalesces with a present one at time 1 + Exp(1).
+func TestSerialBacktrace(t *testing.T) {
+	w := NewWFPopulation(1000, 2, 100, 1e-4, 0, 10)
+	w.SampleTimes = []float64{0, 1}
+	waits := simtest.Replicate(2000, simtest.Seed(t), func(seed int) float64 {
+		w.Seed(seed)
+		w.history = NewEvolutionHistory(2, 100)
+		if err := w.Backtrace(); err != nil {
+			t.Fatal(err)
+		}
+		h := w.GetHistory()
+		if h.Tree[1].Time != 1 || h.TMRCA() <= 1 {
+			t.Fatalf("expected the second genome at time 1 and the root after it, but got %g and %g", h.Tree[1].Time, h.TMRCA())
+		}
+		return h.TMRCA() - 1
+	})
+	f := simtest.NewFamily(t, 1e-3)
+	f.Mean("coalescence time after the older sample", waits, 1)
+	f.KS("coalescence time after the older sample", waits, simtest.ExponentialCDF(1))
+	f.Check()
+
+	// branch lengths start from the sampling times
+	h := w.GetHistory()
+	trees := h.LocalTrees()
+	tmrca := h.TMRCA()
+	a, b := fmt.Sprintf("(0:%g,1:%g);", tmrca, tmrca-1), fmt.Sprintf("(1:%g,0:%g);", tmrca-1, tmrca)
+	if (trees[0].Newick != a && trees[0].Newick != b) || trees[0].Height != tmrca {
+		t.Errorf("expected tree %s of height %g, but got %v", a, tmrca, trees[0])
+	}
+
+	// mutations happen after sampling, on the branches above the genomes
+	w.MutationRate = 1e-2
+	w.Fortrace()
+	for _, m := range w.Mutations() {
+		if m.Time < h.Tree[m.Node].Time {
+			t.Fatalf("mutation %v before the sampling of its genome", m)
+		}
+	}
+
+	// sampling times survive saving and loading
+	var buf bytes.Buffer
+	if err := w.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	v, err := LoadWFPopulation(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.GetHistory().Tree[1].Time != 1 || len(v.SampleTimes) != 2 {
+		t.Errorf("expected the sampling times to be loaded")
+	}
+}
+
+// genomes sampled in the past enter each deme of a structured population.
+func TestSerialStructuredBacktrace(t *testing.T) {
+	w := NewWFPopulation(1000, 4, 100, 1e-4, 1e-4, 10)
+	w.Structure = NewIslandStructure(2, 500, 1e-3, []int{2, 2})
+	w.SampleTimes = []float64{0, 0.5, 0, 2}
+	w.Seed(1)
+	if err := w.Backtrace(); err != nil {
+		t.Fatal(err)
+	}
+	h := w.GetHistory()
+	if len(h.CurrentPool) != 1 {
+		t.Fatalf("expected a single root, but got %v", h.CurrentPool)
+	}
+	for i, s := range w.SampleTimes {
+		if p := h.Tree[i].Parents[0]; h.Tree[p].Time <= s {
+			t.Errorf("genome %d sampled at %g has a parent at %g", i, s, h.Tree[p].Time)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+package coals
+
+import (
+	"bitbucket.org/mingzhi/gsl/randist"
+	"fmt"
+	"github.com/mingzhi/hgt/genome"
+	"math"
+	"sort"
+	"strings"
+)
+
+// The SMC mode walks along the genome instead of building the full history,
+// in the sequentially Markov coalescent SMC′ (Marjoram and Wall 2006), with transfers in place of crossing over.
+// Where a tract begins, a recipient point is drawn uniformly on the current local tree,
+// the branch is cut there, and the lineage below floats up and coalesces back into the tree
+// at rate 1 with each of its lineages, its own branch included, which leaves the tree unchanged.
+// Where the tract ends, the sites return to the ancestry of the recipient:
+// the local tree becomes the one before the tract began,
+// on which the transfers of the tracts still open are made again,
+// each cutting the same clade at the same time and joining it to the same branch,
+// or, if that branch is gone, coalescing back into the tree.
+// Each local tree thus depends only on the previous one and on the tracts the walk is in,
+// and the work grows with the number of tract boundaries, linearly in the genome length.
+// The tracts coalesce only with the lineages of the local tree, not with the other lineages of the full history,
+// and transfers onto branches that earlier transfers created are approximated,
+// so the local trees change less often than in the full history when tracts overlap often.
+
+// a node of a local tree
+type smcNode struct {
+	time     float64
+	parent   int // -1 for the root
+	children []int
+}
+
+// the local tree of the walk, with leaves 0 ... SampleSize-1,
+// and internal nodes reused as the branches move.
+type smcTree struct {
+	nodes []smcNode
+	root  int
+}
+
+// a transfer whose tract the walk is in, to be undone where the tract ends.
+type smcTract struct {
+	end    int      // first position after the tract
+	before *smcTree // local tree before the transfer
+	clade  []int    // sorted leaves below the recipient point
+	cut    float64  // time of the recipient point
+	target []int    // sorted leaves of the branch the clade joined, nil if the transfer left the tree unchanged
+	joined float64  // time the clade joined it
+}
+
+// SMC simulates the sample in the SMC′ approximation,
+// and returns the local trees along the genome and the sequences of the sampled genomes,
+// as LocalTrees and Fortrace do for the full history.
+// Mutations are dropped on the local trees with MutationRate and Model.
+// It simulates a panmictic population of constant size,
+// and panics if Demography, Structure, External or SampleTimes are set.
+func (w *WFPopulation) SMC() (trees []LocalTree, seqMap map[int][]byte) {
+	if w.Demography != nil || w.Structure != nil || w.External != nil || w.SampleTimes != nil {
+		panic("coals: SMC supports a panmictic population of constant size only")
+	}
+	length, fragment := w.GenomeLength, w.TransferLength
+	// Tracts begin at each of the positions of Topology.Starts
+	// at rate Size*TransferRate/positions per unit of branch length.
+	// The walk starts before the first site: on a linear genome, at the first position;
+	// on a circular genome, so that the tracts wrapping around the end cover the first sites.
+	first, last := w.Topology.Starts(fragment, length)
+	lo := first
+	if w.Topology == genome.Circular {
+		lo = 1 - fragment
+		if fragment > length {
+			lo = 1 - length
+		}
+	}
+	rate := float64(w.Size) * w.TransferRate / float64(last-first)
+
+	w.ancestral = randomGenerateSequence(length, w.rng)
+	w.mutations = nil
+	seqs := make([][]byte, w.SampleSize)
+	for i := range seqs {
+		seqs[i] = make([]byte, length)
+		copy(seqs[i], w.ancestral)
+	}
+
+	tree := w.smcKingman()
+	open := []smcTract{} // in order of their beginnings, which is the order of their ends
+	x, pos := lo, float64(lo)
+	// the local tree holds from x up to the position end
+	emit := func(end int) {
+		begin := x
+		if begin < 0 {
+			begin = 0
+		}
+		if end > length {
+			end = length
+		}
+		if begin >= end {
+			return
+		}
+		w.mutateLocalTree(tree, begin, end-1, seqs)
+		newick := tree.newick()
+		if len(trees) > 0 && trees[len(trees)-1].Newick == newick {
+			trees[len(trees)-1].End = end - 1
+		} else {
+			trees = append(trees, LocalTree{Begin: begin, End: end - 1, Newick: newick, Height: tree.nodes[tree.root].time})
+		}
+	}
+	for x < length {
+		// the next tract begins at the site of the continuous position next
+		next := math.Inf(1)
+		if r := rate * tree.length(); r > 0 {
+			next = pos + randist.ExponentialRandomFloat64(w.rng, 1.0/r)
+		}
+		begin := length
+		if next < float64(length) {
+			begin = int(math.Floor(next))
+		}
+
+		if len(open) > 0 && open[0].end <= begin && open[0].end < length {
+			emit(open[0].end)
+			x, pos = open[0].end, float64(open[0].end)
+			tree = open[0].before
+			open = open[1:]
+			for i := range open {
+				w.smcRedo(tree, &open[i])
+			}
+			continue
+		}
+
+		emit(begin)
+		if begin >= length {
+			break
+		}
+		x, pos = begin, next
+		if tract, moved := w.smcTransfer(tree); moved {
+			tract.end = begin + fragment
+			open = append(open, tract)
+		}
+	}
+
+	seqMap = make(map[int][]byte)
+	for i, seq := range seqs {
+		seqMap[i] = seq
+	}
+	return
+}
+
+// a coalescent tree of the sample, whose root is the last node.
+func (w *WFPopulation) smcKingman() *smcTree {
+	nodes := make([]smcNode, w.SampleSize)
+	pool := make([]int, w.SampleSize)
+	for i := range nodes {
+		nodes[i].parent = -1
+		pool[i] = i
+	}
+	t := 0.0
+	for len(pool) > 1 {
+		k := float64(len(pool))
+		t += randist.ExponentialRandomFloat64(w.rng, 2.0/(k*(k-1.0)))
+		i := randist.UniformRandomInt(w.rng, len(pool))
+		j := randist.UniformRandomInt(w.rng, len(pool)-1)
+		if j >= i {
+			j++
+		}
+		a, b := pool[i], pool[j]
+		nodes = append(nodes, smcNode{time: t, parent: -1, children: []int{a, b}})
+		p := len(nodes) - 1
+		nodes[a].parent, nodes[b].parent = p, p
+		pool[i] = p
+		pool[j] = pool[len(pool)-1]
+		pool = pool[:len(pool)-1]
+	}
+	return &smcTree{nodes: nodes, root: len(nodes) - 1}
+}
+
+// a transfer at the beginning of a tract: the branch cut at a recipient point drawn uniformly on the tree
+// coalesces back into it. It returns the transfer to undo at the end of the tract,
+// and false if the branch coalesced with itself, leaving the tree unchanged.
+func (w *WFPopulation) smcTransfer(t *smcTree) (tract smcTract, moved bool) {
+	b, cut := t.point(randist.UniformRandomFloat64(w.rng) * t.length())
+	c, time := w.smcCoalesce(t, b, cut)
+	if c < 0 {
+		return tract, false
+	}
+	tract = smcTract{before: t.copy(), clade: t.leaves(b), cut: cut, joined: time}
+	t.move(b, c, time)
+	tract.target = t.leaves(c)
+	return tract, true
+}
+
+// make the transfer of an open tract again, on the tree without the transfers of the tracts ended before it:
+// the clade, if its branch spans the recipient point, is cut there,
+// and joins the same branch at the same time if the branch spans it,
+// otherwise it coalesces back into the tree.
+func (w *WFPopulation) smcRedo(t *smcTree, tract *smcTract) {
+	tract.before = t.copy()
+	if tract.target == nil {
+		return
+	}
+	b := t.clade(tract.clade)
+	if b < 0 || b == t.root || t.nodes[b].time > tract.cut || t.nodes[t.nodes[b].parent].time <= tract.cut {
+		return
+	}
+	p := t.nodes[b].parent
+	if c := t.clade(tract.target); c >= 0 && t.nodes[c].time <= tract.joined {
+		// the parent of the branch once the clade is cut away
+		pc := t.nodes[c].parent
+		if pc == p {
+			pc = t.nodes[p].parent
+		}
+		if pc < 0 || tract.joined < t.nodes[pc].time {
+			t.move(b, c, tract.joined)
+			return
+		}
+	}
+	c, time := w.smcCoalesce(t, b, tract.cut)
+	if c < 0 {
+		tract.target = nil
+		return
+	}
+	t.move(b, c, time)
+	tract.target, tract.joined = t.leaves(c), time
+}
+
+// the lineage of branch b cut at time cut floats up and coalesces with the lineages of the tree,
+// b included, at rate 1 with each, and above the root with the root.
+// It returns the branch it joins, as it is once b is cut away, and the time,
+// or -1 if it joins b itself.
+func (w *WFPopulation) smcCoalesce(t *smcTree, b int, cut float64) (c int, time float64) {
+	time = cut
+	for {
+		// lineages at the time, and the time the next of them ends
+		lineages := []int{}
+		end := math.Inf(1)
+		for i, n := range t.nodes {
+			if n.time > time || (n.parent >= 0 && t.nodes[n.parent].time <= time) {
+				continue
+			}
+			lineages = append(lineages, i)
+			if n.parent >= 0 && t.nodes[n.parent].time < end {
+				end = t.nodes[n.parent].time
+			}
+		}
+		k := float64(len(lineages))
+		if next := time + randist.ExponentialRandomFloat64(w.rng, 1.0/k); next < end {
+			time = next
+			c = lineages[randist.UniformRandomInt(w.rng, len(lineages))]
+			break
+		}
+		time = end
+	}
+
+	switch c {
+	case b:
+		return -1, time
+	case t.nodes[b].parent:
+		// the parent goes with the cut, and the sibling takes its branch
+		return t.sibling(b), time
+	}
+	return c, time
+}
+
+// cut branch b away with its parent, and join it to branch c at time,
+// c spanning the time once b is cut away.
+func (t *smcTree) move(b, c int, time float64) {
+	p := t.nodes[b].parent
+	s := t.sibling(b)
+	g := t.nodes[p].parent
+	t.nodes[s].parent = g
+	if g >= 0 {
+		t.replaceChild(g, p, s)
+	} else {
+		t.root = s
+	}
+
+	g = t.nodes[c].parent
+	t.nodes[p] = smcNode{time: time, parent: g, children: []int{b, c}}
+	t.nodes[b].parent, t.nodes[c].parent = p, p
+	if g >= 0 {
+		t.replaceChild(g, c, p)
+	} else {
+		t.root = p
+	}
+}
+
+func (t *smcTree) copy() *smcTree {
+	c := &smcTree{nodes: make([]smcNode, len(t.nodes)), root: t.root}
+	for i, n := range t.nodes {
+		c.nodes[i] = smcNode{time: n.time, parent: n.parent, children: append([]int{}, n.children...)}
+	}
+	return c
+}
+
+func (t *smcTree) replaceChild(p, old, child int) {
+	for i, c := range t.nodes[p].children {
+		if c == old {
+			t.nodes[p].children[i] = child
+		}
+	}
+}
+
+func (t *smcTree) sibling(b int) int {
+	children := t.nodes[t.nodes[b].parent].children
+	if children[0] == b {
+		return children[1]
+	}
+	return children[0]
+}
+
+// total length of the branches, below the root.
+func (t *smcTree) length() (total float64) {
+	for i, n := range t.nodes {
+		if i != t.root {
+			total += t.nodes[n.parent].time - n.time
+		}
+	}
+	return
+}
+
+// the point at distance r along the branches, in the order of the nodes below them,
+// as the node below it and its time.
+func (t *smcTree) point(r float64) (b int, time float64) {
+	b = -1
+	for i, n := range t.nodes {
+		if i == t.root {
+			continue
+		}
+		b = i
+		l := t.nodes[n.parent].time - n.time
+		if r < l {
+			break
+		}
+		r -= l
+	}
+	// rounding may leave r past the last branch
+	time = math.Min(t.nodes[b].time+r, t.nodes[t.nodes[b].parent].time)
+	return
+}
+
+// sorted leaves below node n.
+func (t *smcTree) leaves(n int) (leaves []int) {
+	var walk func(n int)
+	walk = func(n int) {
+		if len(t.nodes[n].children) == 0 {
+			leaves = append(leaves, n)
+		}
+		for _, c := range t.nodes[n].children {
+			walk(c)
+		}
+	}
+	walk(n)
+	sort.Ints(leaves)
+	return
+}
+
+// the node whose leaves are the given sorted leaves, -1 if there is none.
+func (t *smcTree) clade(leaves []int) int {
+	n := leaves[0]
+	for {
+		below := t.leaves(n)
+		if len(below) >= len(leaves) {
+			for i := range leaves {
+				if below[i] != leaves[i] {
+					return -1
+				}
+			}
+			if len(below) > len(leaves) {
+				return -1
+			}
+			return n
+		}
+		n = t.nodes[n].parent
+	}
+}
+
+// drop mutations on the local tree of the interval [begin, end],
+// Poisson distributed with rate MutationRate*Size per site and unit of branch length.
+func (w *WFPopulation) mutateLocalTree(t *smcTree, begin, end int, seqs [][]byte) {
+	var model SubstitutionModel = JukesCantor{}
+	if w.Model != nil {
+		model = w.Model
+	}
+	total := t.length()
+	count := randist.PoissonRandomInt(w.rng, w.MutationRate*float64(w.Size)*total*float64(end-begin+1))
+	if count == 0 {
+		return
+	}
+	// numbers of mutations of each site on each branch, named by the node below it
+	sites := make(map[int]map[int]int)
+	for c := 0; c < count; c++ {
+		x := begin + randist.UniformRandomInt(w.rng, end-begin+1)
+		b, _ := t.point(randist.UniformRandomFloat64(w.rng) * total)
+		if sites[x] == nil {
+			sites[x] = make(map[int]int)
+		}
+		sites[x][b]++
+	}
+
+	positions := []int{}
+	for x := range sites {
+		positions = append(positions, x)
+	}
+	sort.Ints(positions)
+	for _, x := range positions {
+		// pass the states down from the root
+		var down func(n int, state byte)
+		down = func(n int, state byte) {
+			for i := 0; i < sites[x][n]; i++ {
+				state = model.Mutate(state, w.rng)
+			}
+			if n < len(seqs) {
+				seqs[n][x] = state
+			}
+			for _, c := range t.nodes[n].children {
+				down(c, state)
+			}
+		}
+		down(t.root, w.ancestral[x])
+	}
+}
+
+// the local tree in Newick format, as written by LocalTrees,
+// with the children of each node in the order of their smallest leaves,
+// so that a tree restored at the end of a tract is written as before it.
+func (t *smcTree) newick() string {
+	first := make([]int, len(t.nodes)) // smallest leaf below each node
+	var smallest func(n int) int
+	smallest = func(n int) int {
+		first[n] = n
+		for i, c := range t.nodes[n].children {
+			if l := smallest(c); i == 0 || l < first[n] {
+				first[n] = l
+			}
+		}
+		return first[n]
+	}
+	smallest(t.root)
+
+	var b strings.Builder
+	var write func(n int)
+	write = func(n int) {
+		children := t.nodes[n].children
+		if len(children) == 0 {
+			fmt.Fprintf(&b, "%d", n)
+			return
+		}
+		children = append([]int{}, children...)
+		sort.Slice(children, func(i, j int) bool { return first[children[i]] < first[children[j]] })
+		b.WriteString("(")
+		for i, c := range children {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			write(c)
+			fmt.Fprintf(&b, ":%g", t.nodes[n].time-t.nodes[c].time)
+		}
+		b.WriteString(")")
+	}
+	write(t.root)
+	b.WriteString(";")
+	return b.String()
+}
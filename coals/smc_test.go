@@ -0,0 +1,118 @@
+package coals
+
+import (
+	"fmt"
+	"github.com/mingzhi/hgt/genome"
+	"github.com/mingzhi/hgt/simtest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSMCTrees(t *testing.T) {
+	sample, length := 10, 10000
+	w := NewWFPopulation(1000, sample, length, 1e-4, 5e-3, 100)
+	w.Seed(1)
+	trees, seqs := w.SMC()
+	if len(trees) < 10 {
+		t.Errorf("expected transfers to change the local trees, but got %d trees", len(trees))
+	}
+	next := 0
+	for _, tree := range trees {
+		if tree.Begin != next {
+			t.Fatalf("tree begins at %d, expected %d", tree.Begin, next)
+		}
+		next = tree.End + 1
+		if tree.Height <= 0 {
+			t.Errorf("tree height %g should be positive", tree.Height)
+		}
+		for i := 0; i < sample; i++ {
+			label := strconv.Itoa(i) + ":"
+			if strings.Count(tree.Newick, "("+label)+strings.Count(tree.Newick, ","+label) != 1 {
+				t.Fatalf("leaf %d should appear once in %s", i, tree.Newick)
+			}
+		}
+	}
+	if next != length {
+		t.Errorf("trees end at %d, expected %d", next, length)
+	}
+	if len(seqs) != sample || len(seqs[0]) != length {
+		t.Errorf("expected %d sequences of length %d", sample, length)
+	}
+
+	// the same seed gives the same trees
+	w.Seed(1)
+	again, _ := w.SMC()
+	if len(again) != len(trees) || again[len(again)-1] != trees[len(trees)-1] {
+		t.Error("expected the same trees with the same seed")
+	}
+}
+
+// without transfers there is a single tree, and with them the local trees
+// keep the diversity of the coalescent, theta = 2 * N * u per site.
+func TestSMCDiversity(t *testing.T) {
+	size, sample, length, mutation := 1000, 10, 1000, 1e-5
+	theta := 2.0 * float64(size) * mutation
+	seed := simtest.Seed(t)
+	f := simtest.NewFamily(t, 1e-3)
+	for _, transfer := range []float64{0, 5e-3} {
+		w := NewWFPopulation(size, sample, length, mutation, transfer, 100)
+		pi := simtest.Replicate(200, seed, func(seed int) float64 {
+			w.Seed(seed)
+			trees, seqs := w.SMC()
+			if transfer == 0 && len(trees) != 1 {
+				t.Fatalf("expected a single tree without transfers, but got %d", len(trees))
+			}
+			return diversity(seqs, sample, length)
+		})
+		f.Mean(fmt.Sprintf("transfer %g: pairwise differences per site", transfer), pi, jukesCantorDiversity(theta))
+	}
+	f.Check()
+}
+
+// with matched parameters, the local trees of SMC′ should approximate the full history of Backtrace:
+// the same TMRCA of the sites, and about as many local trees, where tracts seldom overlap.
+// Here about 4 tracts of 20 sites reach the sample; with two tracts over each site,
+// SMC′ misses the coalescence of the tracts with lineages outside the local trees,
+// and has about a fifth fewer local trees than the full history.
+func TestSMCBacktrace(t *testing.T) {
+	size, sample, length, transfer, fragment := 1000, 5, 1000, 1e-3, 20
+	replicates := 300
+	seed := simtest.Seed(t)
+	f := simtest.NewFamily(t, 1e-3)
+	for _, topology := range []genome.Topology{genome.Circular, genome.Linear} {
+		w := NewWFPopulation(size, sample, length, 0, transfer, fragment)
+		w.Topology = topology
+		smc := simtest.ReplicateAll(replicates, seed, func(seed int) []float64 {
+			w.Seed(seed)
+			trees, _ := w.SMC()
+			newicks := make(map[string]bool)
+			tmrca := 0.0
+			for _, tree := range trees {
+				newicks[tree.Newick] = true
+				tmrca += tree.Height * float64(tree.End-tree.Begin+1)
+			}
+			return []float64{tmrca / float64(length), float64(len(newicks)), float64(len(trees))}
+		})
+		arg := simtest.ReplicateAll(replicates, seed+replicates, func(seed int) []float64 {
+			w.Seed(seed)
+			w.history = NewEvolutionHistory(sample, length)
+			if err := w.Backtrace(); err != nil {
+				t.Fatal(err)
+			}
+			s, err := w.GetHistory().ARGStats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			tmrca := 0.0
+			for _, height := range s.TMRCA {
+				tmrca += height
+			}
+			return []float64{tmrca / float64(length), float64(s.LocalTrees), float64(len(w.LocalTrees()))}
+		})
+		f.KS2(fmt.Sprintf("%v: mean TMRCA of the sites", topology), smc[0], arg[0])
+		f.Equal(fmt.Sprintf("%v: distinct local trees", topology), smc[1], arg[1])
+		f.Equal(fmt.Sprintf("%v: intervals of local trees", topology), smc[2], arg[2])
+	}
+	f.Check()
+}
@@ -0,0 +1,97 @@
+package coals
+
+import (
+	"fmt"
+)
+
+// ARGStats: summary statistics of the ancestral recombination graph of a history,
+// to relate the transfers and the local trees to the covariances of the sample.
+// Times are in the units of the events, Size generations.
+// A site transferred from a donor whose lineage coalesces back with the receiver's
+// keeps the same local tree, but not a clonal ancestry.
+type ARGStats struct {
+	Transfers    int       // transfer events
+	TractLengths []int     // sites of each transferred tract reaching the sample, for the transfers with some
+	LocalTrees   int       // distinct local trees along the genome, by topology and branch lengths
+	TMRCA        []float64 // time of the most recent common ancestor of the sample at each site
+	Clonal       float64   // fraction of the sites whose local tree has no lineage from a transferred tract
+}
+
+// TransferEvents returns the number of transfer events of the history,
+// including the ones whose tract holds no ancestral material of the sample.
+func (h *EvolutionHistory) TransferEvents() (count int) {
+	for _, event := range h.Events {
+		if event.Type == TransferEvent {
+			count++
+		}
+	}
+	return
+}
+
+// TractLengths returns the number of sites each transferred tract passes to the sample,
+// its ancestral material, in the order of the events.
+// Sites of a tract overwritten by more recent transfers, or outside of the genomes of its receiver, do not count.
+// It is empty if the history does not mark its tracts, see Tracts.
+func (h *EvolutionHistory) TractLengths() (lengths []int) {
+	for _, event := range h.Events {
+		if event.Type != TransferEvent {
+			continue
+		}
+		for _, p := range event.Participants {
+			if !h.Tree[p].Tract {
+				continue
+			}
+			sites := 0
+			for _, c := range h.Tree[p].Children {
+				for _, frag := range Intersect(h.Tree[p].Genome, h.Tree[c].Genome) {
+					sites += frag.End - frag.Begin + 1
+				}
+			}
+			lengths = append(lengths, sites)
+		}
+	}
+	return
+}
+
+// ARGStats walks the local trees of the history once and returns its summary statistics.
+// It returns an error for a history with transfers whose nodes do not mark the transferred tracts,
+// such as one saved before they did, as its tracts and clonal fraction cannot be told.
+func (h *EvolutionHistory) ARGStats() (ARGStats, error) {
+	s := ARGStats{Transfers: h.TransferEvents()}
+	if !h.Tracts && s.Transfers > 0 {
+		return s, fmt.Errorf("coals: the history does not mark its transferred tracts, it was saved by an older version")
+	}
+	s.TractLengths = h.TractLengths()
+	breaks := h.breakpoints()
+	length := breaks[len(breaks)-1]
+	s.TMRCA = make([]float64, length)
+	trees := make(map[string]bool)
+	clonal := 0
+	for i := 0; i+1 < len(breaks); i++ {
+		begin, end := breaks[i], breaks[i+1]
+		children, root := h.localTree(begin)
+		trees[h.newick(children, root)] = true
+		height := h.height(root)
+		for x := begin; x < end; x++ {
+			s.TMRCA[x] = height
+		}
+		if h.clonal(root, children) {
+			clonal += end - begin
+		}
+	}
+	s.LocalTrees = len(trees)
+	if length > 0 {
+		s.Clonal = float64(clonal) / float64(length)
+	}
+	return s, nil
+}
+
+// whether no lineage of the local subtree of node n comes from a transferred tract.
+func (h *EvolutionHistory) clonal(n int, children map[int][]int) bool {
+	for _, c := range children[n] {
+		if h.Tree[n].Tract || !h.clonal(c, children) {
+			return false
+		}
+	}
+	return true
+}
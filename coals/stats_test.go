@@ -0,0 +1,129 @@
+package coals
+
+import (
+	"bytes"
+	"github.com/mingzhi/hgt/simtest"
+	"testing"
+)
+
+func TestARGStats(t *testing.T) {
+	// without transfers, a single clonal tree
+	w := NewWFPopulation(1000, 10, 500, 1e-4, 0, 50)
+	w.Seed(simtest.Seed(t))
+	if err := w.Backtrace(); err != nil {
+		t.Fatal(err)
+	}
+	h := w.GetHistory()
+	s, err := h.ARGStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Transfers != 0 || len(s.TractLengths) != 0 || s.LocalTrees != 1 || s.Clonal != 1 {
+		t.Errorf("expected a single clonal tree, but got %+v", s)
+	}
+	for x, height := range s.TMRCA {
+		if height != h.TMRCA() {
+			t.Fatalf("site %d: expected TMRCA %g, but got %g", x, h.TMRCA(), height)
+		}
+	}
+
+	// with transfers, tracts of at most a fragment, and as many local trees as distinct in LocalTrees
+	w = NewWFPopulation(1000, 10, 500, 1e-4, 1e-3, 50)
+	w.Seed(simtest.Seed(t))
+	if err := w.Backtrace(); err != nil {
+		t.Fatal(err)
+	}
+	h = w.GetHistory()
+	s, err = h.ARGStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Transfers == 0 || len(s.TractLengths) == 0 || len(s.TractLengths) > s.Transfers {
+		t.Errorf("expected transfers and their tracts, but got %d transfers and %d tracts", s.Transfers, len(s.TractLengths))
+	}
+	for _, l := range s.TractLengths {
+		if l <= 0 || l > w.TransferLength {
+			t.Errorf("expected tracts of 1 to %d sites, but got %d", w.TransferLength, l)
+		}
+	}
+	newicks := make(map[string]bool)
+	for _, tree := range h.LocalTrees() {
+		newicks[tree.Newick] = true
+		for x := tree.Begin; x <= tree.End; x++ {
+			if s.TMRCA[x] != tree.Height {
+				t.Fatalf("site %d: expected TMRCA %g, but got %g", x, tree.Height, s.TMRCA[x])
+			}
+		}
+	}
+	if s.LocalTrees != len(newicks) {
+		t.Errorf("expected %d distinct local trees, but got %d", len(newicks), s.LocalTrees)
+	}
+	if s.Clonal <= 0 || s.Clonal >= 1 {
+		t.Errorf("expected a part of the genome with clonal ancestry, but got %g", s.Clonal)
+	}
+}
+
+// a history saved before the nodes marked the transferred tracts cannot give its tracts and clonal fraction,
+// and a saved history with them gives the same statistics once loaded.
+func TestARGStatsOlderSave(t *testing.T) {
+	w := NewWFPopulation(1000, 10, 500, 1e-4, 1e-3, 50)
+	w.Seed(simtest.Seed(t))
+	if err := w.Backtrace(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := w.GetHistory().ARGStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := w.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := LoadWFPopulation(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := v.GetHistory().ARGStats(); err != nil || loaded.Clonal != s.Clonal || len(loaded.TractLengths) != len(s.TractLengths) {
+		t.Errorf("expected the statistics %+v of the saved history, but got %+v, %v", s, loaded, err)
+	}
+
+	older := bytes.Replace(buf.Bytes(), []byte(`,"Tract":true`), nil, -1)
+	older = bytes.Replace(older, []byte(`,"Tracts":true`), nil, 1)
+	v, err = LoadWFPopulation(bytes.NewReader(older))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.GetHistory().ARGStats(); err == nil {
+		t.Error("expected an error for a history with transfers but no marked tracts")
+	}
+}
+
+// a site of two genomes has clonal ancestry if they coalesce, at rate 1,
+// before either receives a tract covering it, at rate p * F / L with p = 2 * N * TransferRate,
+// with probability 1 / (1 + p * F / L); their TMRCA has mean 1 at each site.
+func TestClonalFraction(t *testing.T) {
+	size, length, fragment, transfer := 1000, 1000, 100, 5e-3
+	w := NewWFPopulation(size, 2, length, 0, transfer, fragment)
+	samples := simtest.ReplicateAll(500, simtest.Seed(t), func(seed int) []float64 {
+		w.Seed(seed)
+		w.history = NewEvolutionHistory(2, length)
+		if err := w.Backtrace(); err != nil {
+			t.Fatal(err)
+		}
+		s, err := w.GetHistory().ARGStats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmrca := 0.0
+		for _, height := range s.TMRCA {
+			tmrca += height
+		}
+		return []float64{s.Clonal, tmrca / float64(length)}
+	})
+	rate := 2 * float64(size) * transfer * float64(fragment) / float64(length)
+	f := simtest.NewFamily(t, 1e-3)
+	f.Mean("clonal fraction", samples[0], 1/(1+rate))
+	f.Mean("mean TMRCA of the sites", samples[1], 1)
+	f.Check()
+}
@@ -0,0 +1,242 @@
+package coals
+
+import (
+	"bitbucket.org/mingzhi/gsl/randist"
+	"fmt"
+	"math"
+)
+
+// Structure: demes of a structured population, with migration between them.
+// Lineages are labeled by their demes, and coalesce only with lineages in the same deme.
+type Structure struct {
+	Sizes         []float64   // number of genomes in each deme
+	Migration     [][]float64 // Migration[i][j]: fraction of deme i coming from deme j per generation, the rate of a lineage moving from i to j back in time
+	Samples       []int       // number of sampled genomes in each deme, given to the leaves in order
+	LocalTransfer bool        // whether donors of transfers are in the deme of the receiver, otherwise in any deme by its size
+}
+
+// NewIslandStructure returns the island model of demes of the same size,
+// where a lineage migrates at the total rate of migration per generation, to every other deme alike.
+func NewIslandStructure(demes int, size, migration float64, samples []int) *Structure {
+	s := &Structure{Samples: samples}
+	for i := 0; i < demes; i++ {
+		s.Sizes = append(s.Sizes, size)
+		row := make([]float64, demes)
+		for j := range row {
+			if j != i && demes > 1 {
+				row[j] = migration / float64(demes-1)
+			}
+		}
+		s.Migration = append(s.Migration, row)
+	}
+	return s
+}
+
+// Validate checks the structure has a size and a migration row for every deme,
+// and samples adding up to the sample size.
+func (s *Structure) Validate(sample int) error {
+	d := len(s.Sizes)
+	if d == 0 {
+		return fmt.Errorf("structure: no demes")
+	}
+	if len(s.Migration) != d || len(s.Samples) != d {
+		return fmt.Errorf("structure: expected migration rates and samples of %d demes", d)
+	}
+	total := 0
+	for i := 0; i < d; i++ {
+		if s.Sizes[i] <= 0 {
+			return fmt.Errorf("structure: size of deme %d should be positive", i)
+		}
+		if len(s.Migration[i]) != d {
+			return fmt.Errorf("structure: expected %d migration rates from deme %d", d, i)
+		}
+		for _, m := range s.Migration[i] {
+			if m < 0 {
+				return fmt.Errorf("structure: migration rates should not be negative")
+			}
+		}
+		total += s.Samples[i]
+	}
+	if total != sample {
+		return fmt.Errorf("structure: %d sampled genomes in demes, expected %d", total, sample)
+	}
+	return nil
+}
+
+// validateMeeting checks that lineages in any two occupied demes eventually meet in a deme.
+// The sampled demes are occupied, and, if transfers is true, every deme,
+// as donors of transfers may come from any deme.
+// Back in time, a lineage ends up in a closed class of demes, which migration does not leave,
+// so the occupied demes should all lead to the same closed class.
+func (s *Structure) validateMeeting(transfers bool) error {
+	d := len(s.Sizes)
+	// demes reachable from each deme by migration, itself included
+	reach := make([][]bool, d)
+	for i := range reach {
+		reach[i] = make([]bool, d)
+		reach[i][i] = true
+		stack := []int{i}
+		for len(stack) > 0 {
+			k := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for j, m := range s.Migration[k] {
+				if m > 0 && !reach[i][j] {
+					reach[i][j] = true
+					stack = append(stack, j)
+				}
+			}
+		}
+	}
+
+	// a deme is in a closed class if it can return from every deme it reaches,
+	// and the class is labeled by its first deme, or -1 if the deme is not in a closed class.
+	class := make([]int, d)
+	for j := range class {
+		class[j] = -1
+		for k := d - 1; k >= 0; k-- {
+			if !reach[j][k] {
+				continue
+			}
+			if !reach[k][j] {
+				class[j] = -1
+				break
+			}
+			class[j] = k
+		}
+	}
+
+	// closed class reached from the occupied demes
+	reached := -1
+	for i := 0; i < d; i++ {
+		if !transfers && s.Samples[i] == 0 {
+			continue
+		}
+		for j := 0; j < d; j++ {
+			if !reach[i][j] || class[j] < 0 || class[j] == reached {
+				continue
+			}
+			if reached >= 0 {
+				return fmt.Errorf("structure: lineages may end up in demes %d and %d, which never exchange migrants", reached, class[j])
+			}
+			reached = class[j]
+		}
+	}
+	return nil
+}
+
+// backtrace the structured coalescent.
+// In units of Size generations, two lineages of deme i coalesce at rate Size/Sizes[i],
+// a lineage moves from deme i to j at rate Size*Migration[i][j],
+// and receives a transfer at rate Size*TransferRate as in the panmictic coalescent.
+// Demography is not supported, and rejected by validate.
+func (w *WFPopulation) structuredBacktrace() {
+	s := w.Structure
+	h := w.history
+	if len(h.Events) == 0 {
+		// label the sampled genomes
+		leaf := 0
+		for i, n := range s.Samples {
+			for j := 0; j < n; j++ {
+				h.Tree[leaf].Deme = i
+				leaf++
+			}
+		}
+	}
+
+	size := float64(w.Size)
+	p := 2.0 * w.TransferRate * size
+	d := len(s.Sizes)
+	for len(h.CurrentPool) > 1 || len(w.pending) > 0 {
+		demes := make([][]int, d)
+		for _, c := range h.CurrentPool {
+			demes[h.Tree[c].Deme] = append(demes[h.Tree[c].Deme], c)
+		}
+
+		// rates of coalescence in each deme, then of migration from i to j
+		rates := []float64{}
+		total := 0.0
+		for i := 0; i < d; i++ {
+			k := float64(len(demes[i]))
+			rates = append(rates, k*(k-1.0)/2.0*size/s.Sizes[i])
+			total += rates[len(rates)-1]
+		}
+		for i := 0; i < d; i++ {
+			for j := 0; j < d; j++ {
+				rates = append(rates, float64(len(demes[i]))*size*s.Migration[i][j])
+				total += rates[len(rates)-1]
+			}
+		}
+		if total == 0 && len(w.pending) == 0 {
+			panic("coals: lineages in different demes never meet without migration")
+		}
+		transfer := float64(len(h.CurrentPool)) * p / 2.0
+		total += transfer
+
+		etime := math.Inf(1)
+		if total > 0 {
+			etime = randist.ExponentialRandomFloat64(w.rng, 1.0/total)
+		}
+		etime, happens := w.advance(etime)
+		if !happens {
+			continue
+		}
+		r := randist.UniformRandomFloat64(w.rng) * total
+		e := 0
+		for e < len(rates) && r >= rates[e] {
+			r -= rates[e]
+			e++
+		}
+
+		switch {
+		case e < d:
+			ancestor := w.coalescent(demes[e])
+			h.AddEvent(EventNode{Type: CoalescenceEvent, Time: etime, Participants: []int{ancestor}})
+		case e < len(rates):
+			from, to := (e-d)/d, (e-d)%d
+			c := demes[from][randist.UniformRandomInt(w.rng, len(demes[from]))]
+			ancestor := w.migrate(c, to)
+			h.AddEvent(EventNode{Type: MigrationEvent, Time: etime, Participants: []int{ancestor}})
+		default:
+			ancestors, tract := w.transfer()
+			if tract >= 0 {
+				h.Tree[tract].Deme = w.donorDeme(h.Tree[h.Tree[tract].Children[0]].Deme)
+			}
+			h.AddEvent(EventNode{Type: TransferEvent, Time: etime, Participants: ancestors})
+		}
+	}
+}
+
+// move a lineage into another deme, with a node labeled by the new deme.
+func (w *WFPopulation) migrate(c, deme int) int {
+	material := w.material(c)
+	genome := make(Assembly, len(material))
+	copy(genome, material)
+	w.history.Tree = append(w.history.Tree, TreeNode{Genome: genome, Children: []int{c}, Deme: deme})
+	ancestor := len(w.history.Tree) - 1
+
+	// update the current pool
+	w.release(c)
+	w.history.addLineage(ancestor)
+
+	return ancestor
+}
+
+// the deme of the donor of a transfer to a receiver in deme.
+func (w *WFPopulation) donorDeme(deme int) int {
+	s := w.Structure
+	if s.LocalTransfer {
+		return deme
+	}
+	total := 0.0
+	for _, size := range s.Sizes {
+		total += size
+	}
+	r := randist.UniformRandomFloat64(w.rng) * total
+	for i, size := range s.Sizes {
+		if r < size {
+			return i
+		}
+		r -= size
+	}
+	return len(s.Sizes) - 1
+}
@@ -0,0 +1,151 @@
+package coals
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mingzhi/hgt/simtest"
+	"testing"
+)
+
+func TestStructuredBacktrace(t *testing.T) {
+	w := NewWFPopulation(1000, 6, 1000, 1e-4, 2e-3, 100)
+	w.Structure = NewIslandStructure(3, 300, 1e-3, []int{2, 3, 1})
+	w.Structure.LocalTransfer = true
+	w.Seed(1)
+	if err := w.Backtrace(); err != nil {
+		t.Fatal(err)
+	}
+	h := w.GetHistory()
+
+	demes := []int{0, 0, 1, 1, 1, 2}
+	for i, d := range demes {
+		if h.Tree[i].Deme != d {
+			t.Errorf("expected sample %d in deme %d, but got %d", i, d, h.Tree[i].Deme)
+		}
+	}
+	migrations := 0
+	for _, event := range h.Events {
+		a := h.Tree[event.Participants[0]]
+		switch event.Type {
+		case CoalescenceEvent:
+			for _, c := range a.Children {
+				if h.Tree[c].Deme != a.Deme {
+					t.Fatalf("lineages of demes %d and %d coalesce in deme %d", h.Tree[a.Children[0]].Deme, h.Tree[a.Children[1]].Deme, a.Deme)
+				}
+			}
+		case MigrationEvent:
+			migrations++
+			if h.Tree[a.Children[0]].Deme == a.Deme {
+				t.Fatalf("a migration stays in deme %d", a.Deme)
+			}
+		case TransferEvent:
+			for _, p := range event.Participants {
+				if h.Tree[p].Deme != h.Tree[a.Children[0]].Deme {
+					t.Fatalf("a local transfer comes from deme %d into deme %d", h.Tree[p].Deme, h.Tree[a.Children[0]].Deme)
+				}
+			}
+		}
+	}
+	if migrations == 0 {
+		t.Error("expected migrations")
+	}
+
+	// sequences and tables work through the migration nodes
+	seqs := w.Fortrace()
+	if len(seqs) != 6 || len(seqs[5]) != 1000 {
+		t.Errorf("expected 6 sequences of length 1000")
+	}
+	if pops := w.Tables().Populations; len(pops) != 3 {
+		t.Errorf("expected 3 populations, but got %v", pops)
+	}
+
+	// structure is saved
+	var buf bytes.Buffer
+	if err := w.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	v, err := LoadWFPopulation(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Structure == nil || !v.Structure.LocalTransfer || len(v.Structure.Sizes) != 3 {
+		t.Errorf("expected the structure to be loaded, but got %+v", v.Structure)
+	}
+
+	w.Structure.Samples = []int{1, 1, 1}
+	if err := w.Structure.Validate(6); err == nil {
+		t.Error("expected an error for samples not adding up to the sample size")
+	}
+	w = NewWFPopulation(1000, 6, 1000, 1e-4, 5e-3, 100)
+	w.Structure = NewIslandStructure(3, 1000, 1e-3, []int{1, 1, 1})
+	if err := w.Backtrace(); err == nil {
+		t.Error("expected Backtrace to return an error for an invalid structure")
+	}
+}
+
+func TestStructureNeverMeets(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		migration [][]float64
+		samples   []int
+		transfer  float64
+		local     bool
+		valid     bool
+	}{
+		{"no migration", [][]float64{{0, 0}, {0, 0}}, []int{2, 2}, 0, false, false},
+		{"one sampled deme", [][]float64{{0, 0}, {0, 0}}, []int{4, 0}, 0, false, true},
+		{"donors from another deme", [][]float64{{0, 0}, {0, 0}}, []int{4, 0}, 1e-3, false, false},
+		{"local donors", [][]float64{{0, 0}, {0, 0}}, []int{4, 0}, 1e-3, true, true},
+		{"one-way migration", [][]float64{{0, 1e-3}, {0, 0}}, []int{2, 2}, 1e-3, false, true},
+		{"two sinks", [][]float64{{0, 0, 0}, {0, 0, 0}, {1e-3, 1e-3, 0}}, []int{0, 0, 4}, 0, false, false},
+		{"a sink and its source", [][]float64{{0, 1e-3, 0}, {1e-3, 0, 0}, {1e-3, 0, 0}}, []int{1, 1, 2}, 1e-3, false, true},
+	} {
+		w := NewWFPopulation(1000, 4, 100, 0, c.transfer, 10)
+		w.Structure = &Structure{Sizes: make([]float64, len(c.samples)), Migration: c.migration, Samples: c.samples, LocalTransfer: c.local}
+		for i := range w.Structure.Sizes {
+			w.Structure.Sizes[i] = 500
+		}
+		w.Seed(1)
+		err := w.Backtrace()
+		if c.valid && err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("%s: expected an error for demes that never meet", c.name)
+		}
+	}
+
+	w := NewWFPopulation(1000, 4, 100, 0, 0, 10)
+	w.Structure = NewIslandStructure(2, 500, 1e-3, []int{2, 2})
+	w.Demography = Demography{{Start: 0, Size: 1000}}
+	if err := w.Backtrace(); err == nil {
+		t.Error("expected an error for a demography in a structured population")
+	}
+}
+
+// in two demes of half the size, two genomes of the same deme coalesce in mean time 1,
+// and two of different demes in 1 + 1/(2M), M being the scaled migration rate of a lineage.
+func TestStructuredCoalescenceTime(t *testing.T) {
+	seed := simtest.Seed(t)
+	f := simtest.NewFamily(t, 1e-3)
+	for _, c := range []struct {
+		samples  []int
+		expected float64
+	}{
+		{[]int{2, 0}, 1},
+		{[]int{1, 1}, 1.5},
+	} {
+		w := NewWFPopulation(1000, 2, 100, 0, 0, 10)
+		w.Structure = NewIslandStructure(2, 500, 1e-3, c.samples)
+		times := simtest.Replicate(2000, seed, func(seed int) float64 {
+			w.Seed(seed)
+			w.history = NewEvolutionHistory(2, 100)
+			if err := w.Backtrace(); err != nil {
+				t.Fatal(err)
+			}
+			return w.history.TMRCA()
+		})
+		f.Mean(fmt.Sprintf("samples %v: coalescence time", c.samples), times, c.expected)
+	}
+	f.Check()
+}
@@ -0,0 +1,224 @@
+package coals
+
+import (
+	"fmt"
+	"github.com/mingzhi/hgt/fwd"
+	"github.com/mingzhi/hgt/genome"
+	"github.com/mingzhi/hgt/simtest"
+	"math"
+	"testing"
+)
+
+// the forward and the coalescent models place transferred fragments alike.
+// A fragment of F sites begins uniformly at the positions of genome.Topology.Starts:
+// the L sites of a circular genome, and the L+F-1 positions of the fragments overlapping a linear one.
+// A site is covered by a fragment with probability F/L on a circular genome, and F/(L+F-1) on a linear one.
+func TestTopologyTracts(t *testing.T) {
+	length, fragment, tracts := 100, 20, 20000
+	if testing.Short() {
+		tracts = 5000
+	}
+	seed := simtest.Seed(t)
+	f := simtest.NewFamily(t, 1e-3)
+	for _, topology := range []genome.Topology{genome.Circular, genome.Linear} {
+		lo, hi := topology.Starts(fragment, length)
+		expected := float64(fragment) / float64(hi-lo)
+		// standard error of the frequency of a site
+		se := math.Sqrt(expected * (1 - expected) / float64(tracts))
+
+		seqPop := fwd.NewSeqPop(200, length, 0, 1e-4, fragment)
+		seqPop.SetTopology(topology)
+		seqPop.Seed(seed)
+		partPop := fwd.NewSeqPartPop(200, length, 0, 1e-4, fragment)
+		partPop.SetTopology(topology)
+		partPop.Seed(seed)
+
+		freqs := map[string][]float64{
+			"coalescent": coalescentTracts(topology, length, fragment, tracts, seed),
+			"SeqPop":     forwardTracts(seqPop, tracts),
+			"SeqPartPop": forwardTracts(partPop, tracts),
+		}
+		for _, name := range []string{"coalescent", "SeqPop", "SeqPartPop"} {
+			for x := 0; x < length; x++ {
+				f.Z(fmt.Sprintf("%v %s: frequency of site %d in tracts", topology, name, x), freqs[name][x], se, expected)
+			}
+		}
+	}
+	f.Check()
+}
+
+// frequencies of the sites in the tracts of transfers into a single lineage.
+func coalescentTracts(topology genome.Topology, length, fragment, tracts, seed int) []float64 {
+	w := NewWFPopulation(100, 1, length, 0, 1e-3, fragment)
+	w.Topology = topology
+	w.Seed(seed)
+	counts := make([]float64, length)
+	for i := 0; i < tracts; i++ {
+		w.history = NewEvolutionHistory(1, length)
+		w.startBacktrace()
+		if _, tract := w.transfer(); tract >= 0 {
+			for _, frag := range w.history.Tree[tract].Genome {
+				for x := frag.Begin; x <= frag.End; x++ {
+					counts[x]++
+				}
+			}
+		}
+	}
+	for x := range counts {
+		counts[x] /= float64(tracts)
+	}
+	return counts
+}
+
+// frequencies of the sites in the fragments transferred in a forward population,
+// whose genomes are made of a distinct nucleotide each before every generation.
+func forwardTracts(pop fwd.Population, tracts int) []float64 {
+	length := pop.GetLength()
+	counts := make([]float64, length)
+	n := 0
+	for n < tracts {
+		genomes := pop.GetGenomes()
+		for i := range genomes {
+			for x := range genomes[i] {
+				genomes[i][x] = byte(i)
+			}
+		}
+		pop.Evolve()
+		for _, g := range pop.GetGenomes() {
+			// a genome rarely receives two fragments, in a generation of a few transfers,
+			// and keeps its own nucleotide on most of the sites
+			var votes [256]int
+			own := g[0]
+			for _, b := range g {
+				votes[b]++
+				if votes[b] > votes[own] {
+					own = b
+				}
+			}
+			received := false
+			for x, b := range g {
+				if b != own {
+					counts[x]++
+					received = true
+				}
+			}
+			if received {
+				n++
+			}
+		}
+	}
+	for x := range counts {
+		counts[x] /= float64(n)
+	}
+	return counts
+}
+
+// under the linear rule, the forward and the coalescent populations agree on the diversity,
+// and on the linkage near the ends of the genome,
+// where fragments truncated at the ends leave fewer tract boundaries if they begin in the genome only.
+// The linkage of two adjacent blocks of F/2 sites, at an end of the genome,
+// is the mean product of the pairwise differences in the blocks over the product of their means.
+func TestLinearForwardCoalescent(t *testing.T) {
+	size, sample, length, fragment := 100, 10, 200, 100
+	mutation, transfer := 5e-4, 4e-4 // transfer rate per position where a fragment can begin
+	gens, reps := 20*size, 400
+	if testing.Short() {
+		reps = 100
+	}
+	block := fragment / 2
+	blocks := [][2]int{{0, block}, {block, 2 * block}, {length - 2*block, length - block}, {length - block, length}}
+	names := []string{"diversity", "linkage at the left end", "linkage at the right end"}
+	stats := func(seqs []fwd.Sequence) []float64 {
+		var pi float64
+		diffs := make([]float64, len(blocks))
+		products := make([]float64, 2)
+		pairs := 0
+		for i := range seqs {
+			for j := i + 1; j < len(seqs); j++ {
+				d := make([]float64, len(blocks))
+				for b, iv := range blocks {
+					for x := iv[0]; x < iv[1]; x++ {
+						if seqs[i][x] != seqs[j][x] {
+							d[b]++
+						}
+					}
+					diffs[b] += d[b]
+				}
+				for x := range seqs[i] {
+					if seqs[i][x] != seqs[j][x] {
+						pi++
+					}
+				}
+				products[0] += d[0] * d[1]
+				products[1] += d[2] * d[3]
+				pairs++
+			}
+		}
+		n := float64(pairs)
+		return []float64{
+			pi / n / float64(length),
+			products[0] * n / (diffs[0] * diffs[1]),
+			products[1] * n / (diffs[2] * diffs[3]),
+		}
+	}
+
+	// A forward transfer covers a site of a genome at rate transfer*F per generation,
+	// and coalesces two ancestors of the sample there when it copies one onto the other,
+	// at rate 2*transfer*F/(N-1) on top of 1/N: the coalescent runs at the effective size.
+	coverage := transfer * float64(fragment)
+	effective := int(math.Round(float64(size) / (1 + 2*coverage*float64(size)/float64(size-1))))
+	seed := simtest.Seed(t)
+	lo, hi := genome.Linear.Starts(fragment, length)
+	backward := simtest.ReplicateAll(reps, seed, func(seed int) []float64 {
+		w := NewWFPopulation(effective, sample, length, mutation, transfer*float64(hi-lo), fragment)
+		w.Topology = genome.Linear
+		w.Seed(seed)
+		if err := w.Backtrace(); err != nil {
+			t.Fatal(err)
+		}
+		seqMap := w.Fortrace()
+		seqs := make([]fwd.Sequence, sample)
+		for i := range seqs {
+			seqs[i] = seqMap[i]
+		}
+		return stats(seqs)
+	})
+	forward := func(newPop func() forwardPop) []simtest.Sample {
+		return simtest.ReplicateAll(reps, seed, func(seed int) []float64 {
+			pop := newPop()
+			pop.SetTopology(genome.Linear)
+			pop.Seed(seed)
+			for i := 0; i < gens; i++ {
+				pop.Evolve()
+			}
+			genomes, err := fwd.RandomSample(pop, sample, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return stats(fwd.Sequences(genomes))
+		})
+	}
+	forwards := map[string][]simtest.Sample{
+		"SeqPop": forward(func() forwardPop {
+			return fwd.NewSeqPop(size, length, mutation, transfer, fragment)
+		}),
+		"SeqPartPop": forward(func() forwardPop {
+			return fwd.NewSeqPartPop(size, length, mutation, transfer, fragment)
+		}),
+	}
+
+	f := simtest.NewFamily(t, 1e-3)
+	for _, name := range []string{"SeqPop", "SeqPartPop"} {
+		for i, stat := range names {
+			f.Equal(fmt.Sprintf("%s and coalescent: %s", name, stat), forwards[name][i], backward[i])
+		}
+	}
+	f.Check()
+}
+
+// a forward population of settable topology.
+type forwardPop interface {
+	fwd.Population
+	SetTopology(t genome.Topology)
+	Seed(seed int)
+}
@@ -0,0 +1,154 @@
+package coals
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LocalTree: the genealogy of the sample over an interval of the genome.
+type LocalTree struct {
+	Begin  int     // begin position of the interval
+	End    int     // end position of the interval (inclusive, as Fragment)
+	Newick string  // tree in Newick format, with leaves named by their indexes
+	Height float64 // time of the most recent common ancestor of the sample in the interval
+}
+
+func (w *WFPopulation) LocalTrees() []LocalTree {
+	return w.history.LocalTrees()
+}
+
+// LocalTrees walks the history and returns the local tree of each interval,
+// where adjacent intervals with the same tree are joined.
+// Branch lengths are in the time units of the events.
+func (h *EvolutionHistory) LocalTrees() (trees []LocalTree) {
+	breaks := h.breakpoints()
+	for i := 0; i+1 < len(breaks); i++ {
+		begin, end := breaks[i], breaks[i+1]-1
+		children, root := h.localTree(begin)
+		newick := h.newick(children, root)
+		if len(trees) > 0 && trees[len(trees)-1].Newick == newick {
+			trees[len(trees)-1].End = end
+		} else {
+			trees = append(trees, LocalTree{Begin: begin, End: end, Newick: newick, Height: h.height(root)})
+		}
+	}
+	return
+}
+
+// HeightAt returns the time of the most recent common ancestor of the sample at position x.
+func (h *EvolutionHistory) HeightAt(x int) float64 {
+	_, root := h.localTree(x)
+	return h.height(root)
+}
+
+func (h *EvolutionHistory) height(root int) float64 {
+	if root < 0 {
+		return 0
+	}
+	return h.Tree[root].Time
+}
+
+// sorted positions where the ancestral material of any node begins or ends,
+// with the end of the genome as the last one.
+func (h *EvolutionHistory) breakpoints() []int {
+	set := make(map[int]bool)
+	for _, node := range h.Tree {
+		for _, frag := range node.Genome {
+			set[frag.Begin] = true
+			set[frag.End+1] = true
+		}
+	}
+	breaks := []int{}
+	for b := range set {
+		breaks = append(breaks, b)
+	}
+	sort.Ints(breaks)
+	return breaks
+}
+
+// whether the ancestral material of a node contains position x.
+func (n TreeNode) carries(x int) bool {
+	for _, frag := range n.Genome {
+		if frag.Begin <= x && x <= frag.End {
+			return true
+		}
+	}
+	return false
+}
+
+// the parent of a node which inherits position x, -1 if there is none.
+func (h *EvolutionHistory) parentAt(c, x int) int {
+	for _, p := range h.Tree[c].Parents {
+		if h.Tree[p].carries(x) {
+			return p
+		}
+	}
+	return -1
+}
+
+// the local tree at position x, as the local children of the nodes on the lineages of the leaves,
+// and its root, the most recent common ancestor, -1 if no leaf carries x.
+func (h *EvolutionHistory) localTree(x int) (children map[int][]int, root int) {
+	children = make(map[int][]int)
+	top := -1
+	for i, node := range h.Tree {
+		if len(node.Children) != 0 || !node.carries(x) {
+			continue
+		}
+		for c := i; ; {
+			p := h.parentAt(c, x)
+			if p < 0 {
+				top = c
+				break
+			}
+			visited := len(children[p]) > 0
+			children[p] = append(children[p], c)
+			if visited {
+				break
+			}
+			c = p
+		}
+	}
+	if top < 0 {
+		return children, -1
+	}
+
+	// skip the single lineage above the most recent common ancestor
+	root = top
+	for len(children[root]) == 1 {
+		root = children[root][0]
+	}
+	return
+}
+
+// the local tree in Newick format.
+func (h *EvolutionHistory) newick(children map[int][]int, root int) string {
+	if root < 0 {
+		return ";"
+	}
+	var b strings.Builder
+	h.writeNewick(&b, root, children)
+	b.WriteString(";")
+	return b.String()
+}
+
+// write the subtree of node n, skipping nodes with a single local child.
+func (h *EvolutionHistory) writeNewick(b *strings.Builder, n int, children map[int][]int) {
+	if len(children[n]) == 0 {
+		fmt.Fprintf(b, "%d", n)
+		return
+	}
+	b.WriteString("(")
+	for i, c := range children[n] {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		for len(children[c]) == 1 {
+			c = children[c][0]
+		}
+		h.writeNewick(b, c, children)
+		fmt.Fprintf(b, ":%g", h.Tree[n].Time-h.Tree[c].Time)
+	}
+	b.WriteString(")")
+}
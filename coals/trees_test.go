@@ -0,0 +1,119 @@
+package coals
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// a history of three genomes of length 10:
+// genome 2 receives [3, 5] from lineage 4 at time 1,
+// 0 and 3 coalesce at time 2, 1 and 4 at time 2.5, and 5 and 6 at time 3.5.
+func testHistory() *EvolutionHistory {
+	h := NewEvolutionHistory(3, 10)
+	whole := Assembly{Fragment{Begin: 0, End: 9}}
+	h.Tree = append(h.Tree,
+		TreeNode{Genome: Assembly{Fragment{Begin: 0, End: 2}, Fragment{Begin: 6, End: 9}}, Children: []int{2}}, // 3
+		TreeNode{Genome: Assembly{Fragment{Begin: 3, End: 5}}, Children: []int{2}},                             // 4
+		TreeNode{Genome: whole, Children: []int{0, 3}},                                                         // 5
+		TreeNode{Genome: whole, Children: []int{1, 4}},                                                         // 6
+		TreeNode{Genome: whole, Children: []int{5, 6}},                                                         // 7
+	)
+	h.Events = []EventNode{
+		{Time: 1.0, Type: TransferEvent, Participants: []int{3, 4}},
+		{Time: 1.0, Type: CoalescenceEvent, Participants: []int{5}},
+		{Time: 0.5, Type: CoalescenceEvent, Participants: []int{6}},
+		{Time: 1.0, Type: CoalescenceEvent, Participants: []int{7}},
+	}
+	h.CurrentPool = []int{7}
+	h.Link()
+	return h
+}
+
+func TestLocalTrees(t *testing.T) {
+	trees := testHistory().LocalTrees()
+	expected := []LocalTree{
+		{Begin: 0, End: 2, Newick: "((0:2,2:2):1.5,1:3.5);", Height: 3.5},
+		{Begin: 3, End: 5, Newick: "(0:3.5,(1:2.5,2:2.5):1);", Height: 3.5},
+		{Begin: 6, End: 9, Newick: "((0:2,2:2):1.5,1:3.5);", Height: 3.5},
+	}
+	if len(trees) != len(expected) {
+		t.Fatalf("expected %d trees, but got %v", len(expected), trees)
+	}
+	for i := range expected {
+		if trees[i] != expected[i] {
+			t.Errorf("expected %v, but got %v", expected[i], trees[i])
+		}
+	}
+}
+
+func TestSimulatedLocalTrees(t *testing.T) {
+	sample, length := 10, 1000
+	w := NewWFPopulation(1000, sample, length, 1e-4, 2e-3, 100)
+	w.Seed(1)
+	if err := w.Backtrace(); err != nil {
+		t.Fatal(err)
+	}
+	trees := w.LocalTrees()
+	if len(trees) < 2 {
+		t.Errorf("expected transfers to break up the genealogy, but got %d trees", len(trees))
+	}
+	next := 0
+	for _, tree := range trees {
+		if tree.Begin != next {
+			t.Errorf("tree begins at %d, expected %d", tree.Begin, next)
+		}
+		next = tree.End + 1
+		if tree.Height <= 0 || tree.Height > w.GetHistory().TMRCA() {
+			t.Errorf("tree height %g should be in (0, TMRCA]", tree.Height)
+		}
+		for i := 0; i < sample; i++ {
+			label := strconv.Itoa(i) + ":"
+			if strings.Count(tree.Newick, "("+label)+strings.Count(tree.Newick, ","+label) != 1 {
+				t.Errorf("leaf %d should appear once in %s", i, tree.Newick)
+			}
+		}
+	}
+	if next != length {
+		t.Errorf("trees end at %d, expected %d", next, length)
+	}
+}
+
+func TestHistoryTimes(t *testing.T) {
+	h := testHistory()
+	times := []float64{0, 0, 0, 1, 1, 2, 2.5, 3.5}
+	events := []int{-1, -1, -1, 0, 0, 1, 2, 3}
+	for i, node := range h.Tree {
+		if node.Time != times[i] || node.Event != events[i] {
+			t.Errorf("node %d: expected time %g and event %d, but got %g and %d", i, times[i], events[i], node.Time, node.Event)
+		}
+	}
+	if parents := h.Tree[2].Parents; len(parents) != 2 || parents[0] != 3 || parents[1] != 4 {
+		t.Errorf("expected parents [3 4] of node 2, but got %v", parents)
+	}
+	if tmrca := h.TMRCA(); tmrca != 3.5 {
+		t.Errorf("expected TMRCA 3.5, but got %g", tmrca)
+	}
+	if length := h.TotalBranchLength(); length != 10.5 {
+		t.Errorf("expected total branch length 10.5, but got %g", length)
+	}
+	if height := h.HeightAt(4); height != 3.5 {
+		t.Errorf("expected height 3.5 at 4, but got %g", height)
+	}
+
+	// links made during Backtrace should agree with Link
+	w := NewWFPopulation(1000, 10, 1000, 1e-4, 2e-3, 100)
+	w.Seed(1)
+	if err := w.Backtrace(); err != nil {
+		t.Fatal(err)
+	}
+	h = w.GetHistory()
+	linked := make([]TreeNode, len(h.Tree))
+	copy(linked, h.Tree)
+	h.Link()
+	for i, node := range h.Tree {
+		if node.Time != linked[i].Time || node.Event != linked[i].Event || len(node.Parents) != len(linked[i].Parents) {
+			t.Fatalf("node %d: Backtrace gives %+v, but Link gives %+v", i, linked[i], node)
+		}
+	}
+}
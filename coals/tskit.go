@@ -0,0 +1,203 @@
+package coals
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Tables: a genealogy as the node, edge, site, mutation and population tables
+// of a tskit tree sequence, which can be written in tskit's text format.
+// Tables are not tied to the coalescent, any recorded genealogy can fill them.
+type Tables struct {
+	SequenceLength int
+	Nodes          []NodeRow
+	Edges          []EdgeRow
+	Sites          []SiteRow
+	Mutations      []MutationRow
+	Populations    []string // names of populations, stored as their metadata
+}
+
+// NodeRow: a node, with its time in the past.
+type NodeRow struct {
+	IsSample   bool
+	Time       float64
+	Population int
+}
+
+// EdgeRow: the parent of a child over the genome interval [Left, Right).
+type EdgeRow struct {
+	Left, Right   int
+	Parent, Child int
+}
+
+// SiteRow: a site with mutations, and its state at the root.
+type SiteRow struct {
+	Position       int
+	AncestralState byte
+}
+
+// MutationRow: a mutation above a node at a site.
+// Parent is the index of the mutation it overwrites, -1 if there is none.
+type MutationRow struct {
+	Site         int
+	Node         int
+	Time         float64
+	DerivedState byte
+	Parent       int
+}
+
+// Tables returns the tables of the history of the last Backtrace,
+// with the ancestral sequence and the mutations of the last Fortrace.
+func (w *WFPopulation) Tables() *Tables {
+	return w.history.Tables(w.ancestral, w.mutations)
+}
+
+// Tables converts the history into tskit tables.
+// Tree nodes become nodes with their absolute times, the leaves being the samples,
+// and demes become populations pop_0, pop_1, ...
+// Edges cover the ancestral material shared by a parent and a child,
+// a fragment [Begin, End] being the interval [Begin, End+1),
+// and are sorted by the time of the parent, the parent, the child and the left end as tskit requires.
+// Mutations off the ancestral material of their nodes do not reach the sample and are dropped;
+// the remaining ones are listed by site, older first.
+// ancestral can be nil, then there are no sites and mutations.
+func (h *EvolutionHistory) Tables(ancestral []byte, mutations []Mutation) *Tables {
+	breaks := h.breakpoints()
+	t := &Tables{SequenceLength: breaks[len(breaks)-1]}
+
+	for _, node := range h.Tree {
+		t.Nodes = append(t.Nodes, NodeRow{IsSample: len(node.Children) == 0, Time: node.Time, Population: node.Deme})
+		for len(t.Populations) <= node.Deme {
+			t.Populations = append(t.Populations, fmt.Sprintf("pop_%d", len(t.Populations)))
+		}
+	}
+
+	for _, e := range h.edges() {
+		for _, frag := range joinAdjacent(e.material) {
+			t.Edges = append(t.Edges, EdgeRow{Left: frag.Begin, Right: frag.End + 1, Parent: e.parent, Child: e.child})
+		}
+	}
+	sort.Slice(t.Edges, func(i, j int) bool {
+		a, b := t.Edges[i], t.Edges[j]
+		if ta, tb := h.Tree[a.Parent].Time, h.Tree[b.Parent].Time; ta != tb {
+			return ta < tb
+		}
+		if a.Parent != b.Parent {
+			return a.Parent < b.Parent
+		}
+		if a.Child != b.Child {
+			return a.Child < b.Child
+		}
+		return a.Left < b.Left
+	})
+
+	if ancestral != nil {
+		t.addMutations(h, ancestral, mutations)
+	}
+	return t
+}
+
+// join fragments which are next to each other, as tskit edges should not be split.
+func joinAdjacent(a Assembly) (b Assembly) {
+	for _, frag := range sortedCopy(a) {
+		if len(b) > 0 && b[len(b)-1].End+1 == frag.Begin {
+			b[len(b)-1].End = frag.End
+		} else {
+			b = append(b, Fragment{Begin: frag.Begin, End: frag.End})
+		}
+	}
+	return
+}
+
+func (t *Tables) addMutations(h *EvolutionHistory, ancestral []byte, mutations []Mutation) {
+	kept := []Mutation{}
+	for _, m := range mutations {
+		if h.Tree[m.Node].carries(m.Position) && h.parentAt(m.Node, m.Position) >= 0 {
+			kept = append(kept, m)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		if kept[i].Position != kept[j].Position {
+			return kept[i].Position < kept[j].Position
+		}
+		return kept[i].Time > kept[j].Time
+	})
+
+	for i := 0; i < len(kept); {
+		x := kept[i].Position
+		site := len(t.Sites)
+		t.Sites = append(t.Sites, SiteRow{Position: x, AncestralState: ancestral[x]})
+		first := len(t.Mutations)
+		for ; i < len(kept) && kept[i].Position == x; i++ {
+			m := kept[i]
+			// the youngest older mutation on the lineage of the node
+			parent := -1
+			for n := m.Node; n >= 0 && parent < 0; n = h.parentAt(n, x) {
+				for j := len(t.Mutations) - 1; j >= first; j-- {
+					if t.Mutations[j].Node == n {
+						parent = j
+						break
+					}
+				}
+			}
+			t.Mutations = append(t.Mutations, MutationRow{Site: site, Node: m.Node, Time: m.Time, DerivedState: m.State, Parent: parent})
+		}
+	}
+}
+
+// WriteText writes the tables in the text format of tskit.load_text,
+// one writer per table. Population metadata is base64 encoded,
+// as load_text decodes it by default.
+func (t *Tables) WriteText(nodes, edges, sites, mutations, populations io.Writer) error {
+	tables := []struct {
+		w     io.Writer
+		write func(w *bufio.Writer)
+	}{
+		{nodes, func(w *bufio.Writer) {
+			fmt.Fprintln(w, "id\tis_sample\ttime\tpopulation\tindividual")
+			for i, n := range t.Nodes {
+				isSample := 0
+				if n.IsSample {
+					isSample = 1
+				}
+				fmt.Fprintf(w, "%d\t%d\t%v\t%d\t-1\n", i, isSample, n.Time, n.Population)
+			}
+		}},
+		{edges, func(w *bufio.Writer) {
+			fmt.Fprintln(w, "left\tright\tparent\tchild")
+			for _, e := range t.Edges {
+				fmt.Fprintf(w, "%d\t%d\t%d\t%d\n", e.Left, e.Right, e.Parent, e.Child)
+			}
+		}},
+		{sites, func(w *bufio.Writer) {
+			fmt.Fprintln(w, "id\tposition\tancestral_state")
+			for i, s := range t.Sites {
+				fmt.Fprintf(w, "%d\t%d\t%c\n", i, s.Position, s.AncestralState)
+			}
+		}},
+		{mutations, func(w *bufio.Writer) {
+			fmt.Fprintln(w, "id\tsite\tnode\ttime\tderived_state\tparent")
+			for i, m := range t.Mutations {
+				fmt.Fprintf(w, "%d\t%d\t%d\t%v\t%c\t%d\n", i, m.Site, m.Node, m.Time, m.DerivedState, m.Parent)
+			}
+		}},
+		{populations, func(w *bufio.Writer) {
+			fmt.Fprintln(w, "id\tmetadata")
+			for i, name := range t.Populations {
+				fmt.Fprintf(w, "%d\t%s\n", i, base64.StdEncoding.EncodeToString([]byte(name)))
+			}
+		}},
+	}
+
+	for _, table := range tables {
+		bw := bufio.NewWriter(table.w)
+		table.write(bw)
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
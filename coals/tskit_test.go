@@ -0,0 +1,149 @@
+package coals
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTables(t *testing.T) {
+	ancestral := []byte("AAAAAAAAAA")
+	mutations := []Mutation{
+		{Node: 2, Position: 4, State: 'C', Time: 0.5},
+		{Node: 3, Position: 4, State: 'G', Time: 1.5}, // off the material of node 3
+		{Node: 4, Position: 4, State: 'T', Time: 2.2},
+		{Node: 2, Position: 1, State: 'G', Time: 0.5},
+		{Node: 7, Position: 0, State: 'C', Time: 4.0}, // above the root
+	}
+	tables := testHistory().Tables(ancestral, mutations)
+
+	if tables.SequenceLength != 10 {
+		t.Errorf("expected sequence length 10, but got %d", tables.SequenceLength)
+	}
+	if len(tables.Nodes) != 8 || !tables.Nodes[2].IsSample || tables.Nodes[3].IsSample || tables.Nodes[7].Time != 3.5 {
+		t.Errorf("unexpected nodes %v", tables.Nodes)
+	}
+
+	edges := []EdgeRow{
+		{0, 3, 3, 2}, {6, 10, 3, 2}, {3, 6, 4, 2},
+		{0, 10, 5, 0}, {0, 3, 5, 3}, {6, 10, 5, 3},
+		{0, 10, 6, 1}, {3, 6, 6, 4},
+		{0, 10, 7, 5}, {0, 10, 7, 6},
+	}
+	if len(tables.Edges) != len(edges) {
+		t.Fatalf("expected edges %v, but got %v", edges, tables.Edges)
+	}
+	for i := range edges {
+		if tables.Edges[i] != edges[i] {
+			t.Errorf("expected edge %v, but got %v", edges[i], tables.Edges[i])
+		}
+	}
+
+	sites := []SiteRow{{1, 'A'}, {4, 'A'}}
+	muts := []MutationRow{
+		{Site: 0, Node: 2, Time: 0.5, DerivedState: 'G', Parent: -1},
+		{Site: 1, Node: 4, Time: 2.2, DerivedState: 'T', Parent: -1},
+		{Site: 1, Node: 2, Time: 0.5, DerivedState: 'C', Parent: 1},
+	}
+	if len(tables.Sites) != len(sites) || len(tables.Mutations) != len(muts) {
+		t.Fatalf("expected sites %v and mutations %v, but got %v and %v", sites, muts, tables.Sites, tables.Mutations)
+	}
+	for i := range sites {
+		if tables.Sites[i] != sites[i] {
+			t.Errorf("expected site %v, but got %v", sites[i], tables.Sites[i])
+		}
+	}
+	for i := range muts {
+		if tables.Mutations[i] != muts[i] {
+			t.Errorf("expected mutation %v, but got %v", muts[i], tables.Mutations[i])
+		}
+	}
+
+	var nodes, edgeText, siteText, mutText, pops bytes.Buffer
+	if err := tables.WriteText(&nodes, &edgeText, &siteText, &mutText, &pops); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(nodes.String(), "id\tis_sample\ttime\tpopulation\tindividual\n0\t1\t0\t0\t-1\n") {
+		t.Errorf("unexpected node table:\n%s", nodes.String())
+	}
+	if !strings.HasPrefix(edgeText.String(), "left\tright\tparent\tchild\n0\t3\t3\t2\n") {
+		t.Errorf("unexpected edge table:\n%s", edgeText.String())
+	}
+	if siteText.String() != "id\tposition\tancestral_state\n0\t1\tA\n1\t4\tA\n" {
+		t.Errorf("unexpected site table:\n%s", siteText.String())
+	}
+	if !strings.HasSuffix(mutText.String(), "2\t1\t2\t0.5\tC\t1\n") {
+		t.Errorf("unexpected mutation table:\n%s", mutText.String())
+	}
+	if pops.String() != "id\tmetadata\n0\tcG9wXzA=\n" {
+		t.Errorf("unexpected population table:\n%s", pops.String())
+	}
+}
+
+// the tables of a simulation should be consistent,
+// and their mutations should give back the sampled sequences.
+func TestSimulatedTables(t *testing.T) {
+	sample, length := 10, 1000
+	w := NewWFPopulation(1000, sample, length, 1e-4, 2e-3, 100)
+	w.Seed(1)
+	if err := w.Backtrace(); err != nil {
+		t.Fatal(err)
+	}
+	seqMap := w.Fortrace()
+	tables := w.Tables()
+
+	for i, e := range tables.Edges {
+		if tables.Nodes[e.Parent].Time <= tables.Nodes[e.Child].Time {
+			t.Fatalf("edge %v: parent is not older than child", e)
+		}
+		if i > 0 && tables.Nodes[tables.Edges[i-1].Parent].Time > tables.Nodes[e.Parent].Time {
+			t.Fatalf("edges are not sorted by parent time at %d", i)
+		}
+	}
+	if len(tables.Mutations) == 0 {
+		t.Fatal("expected mutations")
+	}
+
+	// the parent of a node at a position
+	parentAt := func(c, x int) int {
+		for _, e := range tables.Edges {
+			if e.Child == c && e.Left <= x && x < e.Right {
+				return e.Parent
+			}
+		}
+		return -1
+	}
+	for _, m := range tables.Mutations {
+		x := tables.Sites[m.Site].Position
+		p := parentAt(m.Node, x)
+		if p < 0 || m.Time < tables.Nodes[m.Node].Time || m.Time > tables.Nodes[p].Time {
+			t.Fatalf("mutation %v is not on the branch above its node", m)
+		}
+	}
+
+	for i := 0; i < sample; i++ {
+		seq := make([]byte, length)
+		copy(seq, w.Ancestral())
+		for s, site := range tables.Sites {
+			// the youngest mutation on the lineage of the sample
+			state := site.AncestralState
+			for n := i; n >= 0; n = parentAt(n, site.Position) {
+				found := false
+				for j := len(tables.Mutations) - 1; j >= 0; j-- {
+					m := tables.Mutations[j]
+					if m.Site == s && m.Node == n {
+						state, found = m.DerivedState, true
+						break
+					}
+				}
+				if found {
+					break
+				}
+			}
+			seq[site.Position] = state
+		}
+		if !bytes.Equal(seq, seqMap[i]) {
+			t.Errorf("sequence of sample %d does not match its mutations", i)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package covs
+
+import (
+	"github.com/mingzhi/hgt/genome"
+	"math"
+)
+
+// Counter accumulates rows of mismatch positions into the counts
+// from which D and Cov are calculated,
+// so that rows can be streamed instead of stored in a CMatrix.
+// The memory of a counter is O(Length + MaxL).
+type Counter struct {
+	Length   int             // genome length
+	MaxL     int             // maximum distance
+	Topology genome.Topology // genome topology
+
+	N     int     // number of rows
+	SumD  float64 // sum of distances
+	SumD2 float64 // sum of squared distances
+	XS    []int   // total counts of each column
+	XY    []int   // total counts of cocurrence
+}
+
+// NewCounter returns an empty counter of distances up to maxL on genomes of the topology.
+func NewCounter(length, maxL int, topology genome.Topology) *Counter {
+	return &Counter{
+		Length:   length,
+		MaxL:     maxL,
+		Topology: topology,
+		XS:       make([]int, length),
+		XY:       make([]int, maxL),
+	}
+}
+
+// Add a row of mismatch positions, which should be sorted.
+func (c *Counter) Add(row []int) {
+	d := float64(len(row)) / float64(c.Length)
+	c.N++
+	c.SumD += d
+	c.SumD2 += d * d
+
+	for xi, xv := range row {
+		// add xs
+		c.XS[xv]++
+		// add xy
+		if c.Topology == genome.Circular {
+			for yi := 0; yi < len(row); {
+				yv := row[yi]
+				if yv < xv { // deal with circle genome
+					if yv+c.Length-xv < c.MaxL {
+						c.XY[yv+c.Length-xv]++
+						yi++
+					} else {
+						yi = xi
+					}
+				} else {
+					if yv-xv < c.MaxL {
+						c.XY[yv-xv]++
+						yi++
+					} else {
+						break
+					}
+				}
+			}
+		} else {
+			for yi := xi; yi < len(row); yi++ {
+				yv := row[yi]
+				if yv-xv < c.MaxL {
+					c.XY[yv-xv]++
+				} else {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Merge the counts of another counter, which has the same length and maxL.
+func (c *Counter) Merge(o *Counter) {
+	c.N += o.N
+	c.SumD += o.SumD
+	c.SumD2 += o.SumD2
+	for j := 0; j < c.Length; j++ {
+		c.XS[j] += o.XS[j]
+	}
+	for j := 0; j < c.MaxL; j++ {
+		c.XY[j] += o.XY[j]
+	}
+}
+
+// D returns the mean and the variance of distances.
+func (c *Counter) D() (m float64, v float64) {
+	n := float64(c.N)
+	if c.N > 0 {
+		m = c.SumD / n
+	}
+	if c.N > 1 {
+		v = (c.SumD2 - c.SumD*c.SumD/n) / (n - 1.0)
+		v = math.Max(v, 0)
+	}
+	return
+}
+
+// Cov returns the covariances of the counted rows.
+func (c *Counter) Cov() (scovs, rcovs, xyPL, xsysPL, smXYPL []float64) {
+	maxL := c.MaxL
+	// calculate xsP (frequency of xs)
+	xsP := make([]float64, c.Length)
+	for i := 0; i < c.Length; i++ {
+		xsP[i] = float64(c.XS[i]) / float64(c.N)
+	}
+
+	// calculate xyP (frequence of xy)
+	xyP := make([]float64, maxL)
+	for i := 0; i < maxL; i++ {
+		if c.Topology == genome.Circular {
+			xyP[i] = float64(c.XY[i]) / (float64(c.N) * float64(c.Length))
+		} else {
+			xyP[i] = float64(c.XY[i]) / float64(c.N*(c.Length-i))
+		}
+	}
+
+	xsysP := make([]float64, maxL) // <X.Y>
+	smXsP := make([]float64, maxL) // sum(X)
+	smYsP := make([]float64, maxL) // sum(Y)
+	for l := 0; l < maxL; l++ {
+		if c.Topology == genome.Circular {
+			for x := 0; x < c.Length; x++ {
+				if x+l >= c.Length {
+					xsysP[l] += xsP[x] * xsP[l-(c.Length-x)]
+					smXsP[l] += xsP[x]
+					smYsP[l] += xsP[l-(c.Length-x)]
+				} else {
+					xsysP[l] += xsP[x] * xsP[x+l]
+					smXsP[l] += xsP[x]
+					smYsP[l] += xsP[x+l]
+				}
+			}
+			xsysP[l] /= float64(c.Length)
+			smXsP[l] /= float64(c.Length)
+			smYsP[l] /= float64(c.Length)
+		} else {
+			for x := 0; x < c.Length-l; x++ {
+				xsysP[l] += xsP[x] * xsP[x+l]
+				smXsP[l] += xsP[x]
+				smYsP[l] += xsP[x+l]
+			}
+			xsysP[l] /= float64(c.Length - l)
+			smXsP[l] /= float64(c.Length - l)
+			smYsP[l] /= float64(c.Length - l)
+		}
+	}
+
+	scovs = make([]float64, maxL)
+	rcovs = make([]float64, maxL)
+	xyPL = make([]float64, maxL)
+	xsysPL = make([]float64, maxL)
+	smXYPL = make([]float64, maxL)
+	for l := 0; l < maxL; l++ {
+		scovs[l] = xyP[l] - xsysP[l]
+		rcovs[l] = xsysP[l] - smXsP[l]*smYsP[l]
+		xyPL[l] = xyP[l]
+		xsysPL[l] = xsysP[l]
+		smXYPL[l] = smXsP[l] * smYsP[l]
+	}
+
+	return
+}
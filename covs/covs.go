@@ -2,6 +2,7 @@ package covs
 
 import (
 	"github.com/mingzhi/gomath/stat/desc"
+	"github.com/mingzhi/hgt/genome"
 	"math"
 	"runtime"
 	"sort"
@@ -42,245 +43,42 @@ func (cm *CMatrix) D() (m float64, v float64) {
 
 // Calculate the covs.
 func (cm *CMatrix) Cov(maxL int) (scovs, rcovs, xyPL, xsysPL, smXYPL []float64) {
-	// calculate xs and xy
-	xs := make([]int, cm.Length) // total counts of each column.
-	xy := make([]int, maxL)      // total counts of cocurrence.
-	// number of cpu
-	ncpu := runtime.GOMAXPROCS(0)
-	ch := make(chan result)
-	for i := 0; i < ncpu; i++ {
-		begin := i * cm.Size / ncpu
-		end := (i + 1) * cm.Size / ncpu
-		go cm.covSome(begin, end, maxL, ch)
-	}
-	// collect results
-	for i := 0; i < ncpu; i++ {
-		r := <-ch
-		for j := 0; j < cm.Length; j++ {
-			xs[j] += r.xs[j]
-		}
-		for j := 0; j < maxL; j++ {
-			xy[j] += r.xy[j]
-		}
-	}
-
-	// calculate xsP (frequency of xs)
-	xsP := make([]float64, len(xs))
-	for i := 0; i < len(xs); i++ {
-		xsP[i] = float64(xs[i]) / float64(cm.Size)
-	}
-
-	// calculate xyP (frequence of xy)
-	xyP := make([]float64, len(xy))
-	for i := 0; i < len(xy); i++ {
-		xyP[i] = float64(xy[i]) / float64(cm.Size*(cm.Length-i))
-	}
-
-	xsysP := make([]float64, maxL) // <X.Y>
-	smXsP := make([]float64, maxL) // sum(X)
-	smYsP := make([]float64, maxL) // sum(Y)
-	for l := 0; l < maxL; l++ {
-		for x := 0; x < cm.Length-l; x++ {
-			xsysP[l] += xsP[x] * xsP[x+l]
-			smXsP[l] += xsP[x]
-			smYsP[l] += xsP[x+l]
-		}
-		xsysP[l] /= float64(cm.Length - l)
-		smXsP[l] /= float64(cm.Length - l)
-		smYsP[l] /= float64(cm.Length - l)
-	}
-
-	scovs = make([]float64, maxL)
-	rcovs = make([]float64, maxL)
-	xyPL = make([]float64, maxL)
-	xsysPL = make([]float64, maxL)
-	smXYPL = make([]float64, maxL)
-	for l := 0; l < maxL; l++ {
-		scovs[l] = xyP[l] - xsysP[l]
-		rcovs[l] = xsysP[l] - smXsP[l]*smYsP[l]
-		xyPL[l] = xyP[l]
-		xsysPL[l] = xsysP[l]
-		smXYPL[l] = smXsP[l] * smYsP[l]
-	}
-
-	return
+	return cm.count(maxL, genome.Linear).Cov()
 }
 
-type result struct {
-	xs []int
-	xy []int
-}
-
-func (cm *CMatrix) covCircleSome(begin, end, maxL int, ch chan result) {
-	// calculate xs and xy
-	xs := make([]int, cm.Length) // total counts of each column.
-	xy := make([]int, maxL)      // total counts of cocurrence.
-	// sort each row
-	for i := begin; i < end; i++ {
-		sort.Ints(cm.Matrix[i])
-	}
-	// loop
-	for i := begin; i < end; i++ {
-		row := cm.Matrix[i]
-		for xi, xv := range row {
-			// add xs
-			xs[xv]++
-			// add xy
-			for yi := 0; yi < len(row); {
-				yv := row[yi]
-				if yv < xv { // deal with circle genome
-					if yv+cm.Length-xv < maxL {
-						xy[yv+cm.Length-xv]++
-						yi++
-					} else {
-						yi = xi
-					}
-				} else {
-					if yv-xv < maxL {
-						xy[yv-xv]++
-						yi++
-					} else {
-						break
-					}
-				}
-			}
-		}
-	}
-
-	ch <- result{xs: xs, xy: xy}
+// Calculate the covs.
+func (cm *CMatrix) CovCircle(maxL int) (scovs, rcovs, xyPL, xsysPL, smXYPL []float64) {
+	return cm.count(maxL, genome.Circular).Cov()
 }
 
-func (cm *CMatrix) covSome(begin, end, maxL int, ch chan result) {
-	// calculate xs and xy
-	xs := make([]int, cm.Length) // total counts of each column.
-	xy := make([]int, maxL)      // total counts of cocurrence.
-
-	// loop
-	for i := begin; i < end; i++ {
-		row := cm.Matrix[i]
-		sort.Ints(row)
-		for xi, xv := range row {
-			// add xs
-			xs[xv]++
-			// add xy
-			for yi := xi; yi < len(row); yi++ {
-				yv := row[yi]
-				if yv-xv < maxL {
-					xy[yv-xv]++
-				} else {
-					break
-				}
-			}
-		}
-	}
-
-	ch <- result{xs: xs, xy: xy}
+// Calculate the covs on genomes of the topology, as Cov or CovCircle.
+func (cm *CMatrix) CovTopology(maxL int, topology genome.Topology) (scovs, rcovs, xyPL, xsysPL, smXYPL []float64) {
+	return cm.count(maxL, topology).Cov()
 }
 
-// Calculate the covs.
-func (cm *CMatrix) CovCircle(maxL int) (scovs, rcovs, xyPL, xsysPL, smXYPL []float64) {
-	// calculate xs and xy
-	xs := make([]int, cm.Length) // total counts of each column.
-	xy := make([]int, maxL)      // total counts of cocurrence.
+// count the rows of the matrix in parallel.
+func (cm *CMatrix) count(maxL int, topology genome.Topology) *Counter {
 	// number of cpu
 	ncpu := runtime.GOMAXPROCS(0)
-	ch := make(chan result)
+	ch := make(chan *Counter)
 	for i := 0; i < ncpu; i++ {
 		begin := i * cm.Size / ncpu
 		end := (i + 1) * cm.Size / ncpu
-		go cm.covCirclePart(begin, end, maxL, ch)
+		go func(begin, end int) {
+			c := NewCounter(cm.Length, maxL, topology)
+			for j := begin; j < end; j++ {
+				row := cm.Matrix[j]
+				sort.Ints(row)
+				c.Add(row)
+			}
+			ch <- c
+		}(begin, end)
 	}
 	// collect results
+	total := NewCounter(cm.Length, maxL, topology)
 	for i := 0; i < ncpu; i++ {
-		r := <-ch
-		for j := 0; j < cm.Length; j++ {
-			xs[j] += r.xs[j]
-		}
-		for j := 0; j < maxL; j++ {
-			xy[j] += r.xy[j]
-		}
-	}
-
-	// calculate xsP (frequency of xs)
-	xsP := make([]float64, len(xs))
-	for i := 0; i < len(xs); i++ {
-		xsP[i] = float64(xs[i]) / float64(cm.Size)
-	}
-
-	// calculate xyP (frequence of xy)
-	xyP := make([]float64, len(xy))
-	for i := 0; i < len(xy); i++ {
-		xyP[i] = float64(xy[i]) / (float64(cm.Size) * float64(cm.Length))
-	}
-
-	xsysP := make([]float64, maxL) // <X.Y>
-	smXsP := make([]float64, maxL) // sum(X)
-	smYsP := make([]float64, maxL) // sum(Y)
-	for l := 0; l < maxL; l++ {
-		for x := 0; x < cm.Length; x++ {
-			if x+l >= cm.Length {
-				xsysP[l] += xsP[x] * xsP[l-(cm.Length-x)]
-				smXsP[l] += xsP[x]
-				smYsP[l] += xsP[l-(cm.Length-x)]
-			} else {
-				xsysP[l] += xsP[x] * xsP[x+l]
-				smXsP[l] += xsP[x]
-				smYsP[l] += xsP[x+l]
-			}
-		}
-		xsysP[l] /= float64(cm.Length)
-		smXsP[l] /= float64(cm.Length)
-		smYsP[l] /= float64(cm.Length)
-	}
-
-	scovs = make([]float64, maxL)
-	rcovs = make([]float64, maxL)
-	xyPL = make([]float64, maxL)
-	xsysPL = make([]float64, maxL)
-	smXYPL = make([]float64, maxL)
-	for l := 0; l < maxL; l++ {
-		scovs[l] = xyP[l] - xsysP[l]
-		rcovs[l] = xsysP[l] - smXsP[l]*smYsP[l]
-		xyPL[l] = xyP[l]
-		xsysPL[l] = xsysP[l]
-		smXYPL[l] = smXsP[l] * smYsP[l]
-	}
-
-	return
-}
-
-func (cm *CMatrix) covCirclePart(begin, end, maxL int, ch chan result) {
-	// calculate xs and xy
-	xs := make([]int, cm.Length) // total counts of each column.
-	xy := make([]int, maxL)      // total counts of cocurrence.
-	// loop
-	for i := begin; i < end; i++ {
-		row := cm.Matrix[i]
-		sort.Ints(row)
-		for xi, xv := range row {
-			// add xs
-			xs[xv]++
-			// add xy
-			for yi := 0; yi < len(row); {
-				yv := row[yi]
-				if yv < xv { // deal with circle genome
-					if yv+cm.Length-xv < maxL {
-						xy[yv+cm.Length-xv]++
-						yi++
-					} else {
-						yi = xi
-					}
-				} else {
-					if yv-xv < maxL {
-						xy[yv-xv]++
-						yi++
-					} else {
-						break
-					}
-				}
-			}
-		}
+		total.Merge(<-ch)
 	}
 
-	ch <- result{xs: xs, xy: xy}
+	return total
 }
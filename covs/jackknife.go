@@ -0,0 +1,168 @@
+package covs
+
+import (
+	"github.com/mingzhi/hgt/genome"
+	"math"
+)
+
+// Jackknife counts mismatch rows like a Counter,
+// and estimates standard errors by a delete-a-group jackknife over genomes.
+// Pairs sharing a genome are not independent,
+// so genomes (not pairs) are the resampling units:
+// each genome belongs to one of the groups,
+// and each jackknife replicate drops every row that involves a genome of one group.
+// The groups may hold different numbers of genomes,
+// e.g. when the genomes do not divide evenly among them,
+// so the replicates are weighted by the sizes of the groups they drop
+// (the delete-a-group jackknife of Busing, Meijer and van der Leeden 1999).
+type Jackknife struct {
+	Total  *Counter   // counts of all rows
+	Groups []*Counter // counts of the rows involving each group
+
+	units []map[int]bool // genomes seen in each group
+}
+
+func NewJackknife(length, maxL int, topology genome.Topology, groups int) *Jackknife {
+	j := &Jackknife{Total: NewCounter(length, maxL, topology)}
+	j.Groups = make([]*Counter, groups)
+	j.units = make([]map[int]bool, groups)
+	for g := range j.Groups {
+		j.Groups[g] = NewCounter(length, maxL, topology)
+		j.units[g] = make(map[int]bool)
+	}
+	return j
+}
+
+// Add a row of mismatch positions, which should be sorted.
+// genomes are the indexes of the resampling units the row involves,
+// e.g. both genomes of a random pair, or only the non-reference genome
+// when all pairs share a fixed reference.
+func (j *Jackknife) Add(row []int, genomes ...int) {
+	j.Total.Add(row)
+	added := make(map[int]bool, len(genomes))
+	for _, genome := range genomes {
+		g := genome % len(j.Groups)
+		j.units[g][genome] = true
+		if !added[g] {
+			j.Groups[g].Add(row)
+			added[g] = true
+		}
+	}
+}
+
+// Merge the counts of another jackknife, which has the same parameters.
+func (j *Jackknife) Merge(o *Jackknife) {
+	j.Total.Merge(o.Total)
+	for g := range j.Groups {
+		j.Groups[g].Merge(o.Groups[g])
+		for genome := range o.units[g] {
+			j.units[g][genome] = true
+		}
+	}
+}
+
+// D returns the mean and the variance of distances.
+func (j *Jackknife) D() (m float64, v float64) {
+	return j.Total.D()
+}
+
+// DErr returns the standard errors of the mean and the variance of distances.
+func (j *Jackknife) DErr() (mErr float64, vErr float64) {
+	m, v := j.D()
+	reps, h := j.replicates()
+	ms, vs := make([]float64, len(reps)), make([]float64, len(reps))
+	for i, c := range reps {
+		ms[i], vs[i] = c.D()
+	}
+	return jackknifeErr(m, ms, h), jackknifeErr(v, vs, h)
+}
+
+// Cov returns the covariances of all rows.
+func (j *Jackknife) Cov() (scovs, rcovs, xyPL, xsysPL, smXYPL []float64) {
+	return j.Total.Cov()
+}
+
+// CovErr returns the standard errors of the covariances returned by Cov.
+func (j *Jackknife) CovErr() (scovs, rcovs, xyPL, xsysPL, smXYPL []float64) {
+	maxL := j.Total.MaxL
+	s, r, xy, xsys, smxy := j.Cov()
+	full := [5][]float64{s, r, xy, xsys, smxy}
+	counters, h := j.replicates()
+	reps := [5][][]float64{}
+	for _, c := range counters {
+		s, r, xy, xsys, smxy := c.Cov()
+		for k, curve := range [][]float64{s, r, xy, xsys, smxy} {
+			reps[k] = append(reps[k], curve)
+		}
+	}
+
+	errs := [5][]float64{}
+	for k := range errs {
+		errs[k] = make([]float64, maxL)
+		for l := 0; l < maxL; l++ {
+			values := make([]float64, len(reps[k]))
+			for i, curve := range reps[k] {
+				values[i] = curve[l]
+			}
+			errs[k][l] = jackknifeErr(full[k][l], values, h)
+		}
+	}
+
+	return errs[0], errs[1], errs[2], errs[3], errs[4]
+}
+
+// leave-one-group-out counters,
+// and for each the ratio h of all genomes to the genomes of the dropped group.
+// groups whose removal leaves no rows are skipped.
+func (j *Jackknife) replicates() (reps []*Counter, h []float64) {
+	total := 0
+	for _, units := range j.units {
+		total += len(units)
+	}
+	for g, group := range j.Groups {
+		if group.N == 0 || group.N == j.Total.N {
+			continue
+		}
+		c := NewCounter(j.Total.Length, j.Total.MaxL, j.Total.Topology)
+		c.Merge(j.Total)
+		c.subtract(group)
+		reps = append(reps, c)
+		h = append(h, float64(total)/float64(len(j.units[g])))
+	}
+	return
+}
+
+// subtract the counts of another counter.
+func (c *Counter) subtract(o *Counter) {
+	c.N -= o.N
+	c.SumD -= o.SumD
+	c.SumD2 -= o.SumD2
+	for i := 0; i < c.Length; i++ {
+		c.XS[i] -= o.XS[i]
+	}
+	for i := 0; i < c.MaxL; i++ {
+		c.XY[i] -= o.XY[i]
+	}
+}
+
+// weighted jackknife standard error of the estimate full of all rows,
+// given the replicate estimates values, each dropping a group of 1/h of the genomes.
+// With groups of equal sizes, h is the number of groups,
+// and this reduces to the usual sqrt((g-1)/g * sum (values - mean)^2).
+func jackknifeErr(full float64, values, h []float64) float64 {
+	g := float64(len(values))
+	if g < 2 {
+		return math.NaN()
+	}
+	// jackknife estimate
+	est := g * full
+	for i, v := range values {
+		est -= (1 - 1/h[i]) * v
+	}
+	ss := 0.0
+	for i, v := range values {
+		pseudo := h[i]*full - (h[i]-1)*v
+		ss += (pseudo - est) * (pseudo - est) / (h[i] - 1)
+	}
+	return math.Sqrt(ss / g)
+}
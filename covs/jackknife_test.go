@@ -0,0 +1,79 @@
+package covs
+
+import (
+	"github.com/mingzhi/hgt/genome"
+	"github.com/mingzhi/hgt/simtest"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestJackknifeErr(t *testing.T) {
+	// independent rows, each row is its own resampling unit,
+	// so the jackknife variance of the mean is unbiased for var(d) / n,
+	// d being a binomial proportion of p over the sites of a row.
+	size := 2000
+	leng := 100
+	p := 0.1
+	se := math.Sqrt(p * (1 - p) / float64(leng) / float64(size))
+	var jk *Jackknife
+	samples := simtest.ReplicateAll(50, simtest.Seed(t), func(seed int) []float64 {
+		rng := rand.New(rand.NewSource(int64(seed)))
+		jk = NewJackknife(leng, 10, genome.Linear, 20)
+		for i := 0; i < size; i++ {
+			row := []int{}
+			for j := 0; j < leng; j++ {
+				if rng.Float64() < p {
+					row = append(row, j)
+				}
+			}
+			jk.Add(row, i)
+		}
+		m, _ := jk.D()
+		mErr, _ := jk.DErr()
+		return []float64{(m - p) / se, mErr * mErr}
+	})
+
+	f := simtest.NewFamily(t, 1e-3)
+	f.KS("standardized mean", samples[0], simtest.NormalCDF)
+	f.Mean("jackknife variance of the mean", samples[1], se*se)
+	f.Check()
+
+	scovsErr, _, _, _, _ := jk.CovErr()
+	for l, e := range scovsErr {
+		if math.IsNaN(e) || e <= 0 {
+			t.Errorf("%d: invalid standard error %g", l, e)
+		}
+	}
+}
+
+func TestJackknifeUnequalGroups(t *testing.T) {
+	// 6 genomes in 4 groups of 2, 2, 1 and 1 genomes, one row each.
+	// For the mean, the weighted pseudo-values are the means of the groups,
+	// so the jackknife variance is sum (mean_g - mean)^2 / (h_g - 1) / groups,
+	// with h_g = 6 / size of group g.
+	leng := 10
+	rows := [][]int{{0}, {1, 2}, {}, {3, 4, 5}, {6}, {7, 8}}
+	groups := 4
+	jk := NewJackknife(leng, 5, genome.Linear, groups)
+	means := make([]*Counter, groups)
+	for g := range means {
+		means[g] = NewCounter(leng, 5, genome.Linear)
+	}
+	for i, row := range rows {
+		jk.Add(row, i)
+		means[i%groups].Add(row)
+	}
+
+	m, _ := jk.D()
+	v := 0.0
+	for _, c := range means {
+		mg, _ := c.D()
+		h := float64(len(rows)) / float64(c.N)
+		v += (mg - m) * (mg - m) / (h - 1)
+	}
+	expected := math.Sqrt(v / float64(groups))
+	if mErr, _ := jk.DErr(); math.Abs(mErr-expected) > 1e-12 {
+		t.Errorf("jackknife error of the mean: got %g, expected %g", mErr, expected)
+	}
+}
@@ -0,0 +1,126 @@
+package fwd
+
+import (
+	"fmt"
+	"github.com/mingzhi/hgt/covs"
+	"github.com/mingzhi/hgt/genome"
+	"runtime"
+)
+
+// Pair: indexes of two genomes.
+type Pair struct {
+	A, B int
+}
+
+// number of groups of genomes used by the jackknife standard errors.
+const JackknifeGroups = 20
+
+// AllPairs: returns all the n(n-1)/2 pairs of n genomes,
+// in the order of GenerateDistanceMatrix.
+func AllPairs(n int) []Pair {
+	pairs := []Pair{}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			pairs = append(pairs, Pair{i, j})
+		}
+	}
+	return pairs
+}
+
+// RandomPairs: returns size distinct pairs drawn at random from n genomes.
+func RandomPairs(rng Rand, n, size int) ([]Pair, error) {
+	total := n * (n - 1) / 2
+	if size < 0 || size > total {
+		return nil, fmt.Errorf("cannot draw %d pairs from %d genomes", size, n)
+	}
+
+	// draw from all pairs when most of them are wanted.
+	if size > total/2 {
+		all := AllPairs(n)
+		idxes, err := draw(rng, total, size, false)
+		if err != nil {
+			return nil, err
+		}
+		pairs := make([]Pair, size)
+		for i, idx := range idxes {
+			pairs[i] = all[idx]
+		}
+		return pairs, nil
+	}
+
+	// otherwise reject the pairs already drawn.
+	pairs := []Pair{}
+	drawn := make(map[Pair]bool)
+	for len(pairs) < size {
+		a, b := rng.Intn(n), rng.Intn(n)
+		if a == b {
+			continue
+		}
+		if a > b {
+			a, b = b, a
+		}
+		p := Pair{a, b}
+		if !drawn[p] {
+			drawn[p] = true
+			pairs = append(pairs, p)
+		}
+	}
+
+	return pairs, nil
+}
+
+// ReferencePairs: returns the pairs of a reference genome versus the other n-1 genomes.
+func ReferencePairs(ref, n int) []Pair {
+	pairs := []Pair{}
+	for i := 0; i < n; i++ {
+		if i != ref {
+			pairs = append(pairs, Pair{ref, i})
+		}
+	}
+	return pairs
+}
+
+// PairCovs: count mismatches of the given pairs of genomes,
+// with standard errors estimated by a jackknife over both genomes of the pairs.
+func PairCovs(genomes []Sequence, pairs []Pair, maxL int, topology genome.Topology) *covs.Jackknife {
+	return streamPairs(genomes, pairs, maxL, topology, func(p Pair) []int { return []int{p.A, p.B} })
+}
+
+// ReferenceCovs: count mismatches of a reference genome versus the others,
+// with standard errors estimated by a jackknife over the other genomes.
+func ReferenceCovs(genomes []Sequence, ref, maxL int, topology genome.Topology) *covs.Jackknife {
+	pairs := ReferencePairs(ref, len(genomes))
+	return streamPairs(genomes, pairs, maxL, topology, func(p Pair) []int { return []int{p.B} })
+}
+
+// count pairs in parallel, units returns the resampling units of a pair.
+func streamPairs(genomes []Sequence, pairs []Pair, maxL int, topology genome.Topology, units func(p Pair) []int) *covs.Jackknife {
+	length := 0
+	if len(genomes) > 0 {
+		length = len(genomes[0])
+	}
+
+	ncpu := runtime.GOMAXPROCS(0)
+	ch := make(chan *covs.Jackknife)
+	for w := 0; w < ncpu; w++ {
+		begin := w * len(pairs) / ncpu
+		end := (w + 1) * len(pairs) / ncpu
+		go func(begin, end int) {
+			j := covs.NewJackknife(length, maxL, topology, JackknifeGroups)
+			ds := make([]int, 0, length) // buffer of mismatch positions
+			for _, p := range pairs[begin:end] {
+				ds = mismatches(genomes[p.A], genomes[p.B], ds[:0])
+				j.Add(ds, units(p)...)
+			}
+			ch <- j
+		}(begin, end)
+	}
+
+	// collect results
+	total := covs.NewJackknife(length, maxL, topology, JackknifeGroups)
+	for w := 0; w < ncpu; w++ {
+		total.Merge(<-ch)
+	}
+
+	return total
+}
@@ -0,0 +1,57 @@
+package fwd
+
+import (
+	"github.com/mingzhi/hgt/genome"
+	"math"
+	"testing"
+)
+
+func TestRandomPairs(t *testing.T) {
+	pop := NewSeqPartPop(10, 50, 1e-3, 0, 0)
+	pop.Seed(1)
+	for _, size := range []int{10, 40, 45} {
+		pairs, err := RandomPairs(pop, 10, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pairs) != size {
+			t.Errorf("expected %d pairs, but got %d", size, len(pairs))
+		}
+		drawn := make(map[Pair]bool)
+		for _, p := range pairs {
+			if p.A >= p.B || drawn[p] {
+				t.Errorf("invalid or duplicated pair %v", p)
+			}
+			drawn[p] = true
+		}
+	}
+
+	if _, err := RandomPairs(pop, 10, 46); err == nil {
+		t.Error("expected an error when drawing more pairs than exist")
+	}
+}
+
+func TestPairCovs(t *testing.T) {
+	pop := NewSeqPartPop(30, 300, 1e-3, 1e-3, 30)
+	pop.Seed(1)
+	for i := 0; i < 30; i++ {
+		pop.Evolve()
+	}
+
+	maxl := 20
+	counter := StreamCovs(pop.Genomes, maxl, genome.Linear)
+	jk := PairCovs(pop.Genomes, AllPairs(len(pop.Genomes)), maxl, genome.Linear)
+	m1, _ := counter.D()
+	m2, _ := jk.D()
+	if counter.N != jk.Total.N || math.Abs(m1-m2) > 1e-12 {
+		t.Errorf("expected %d pairs with mean %g, but got %d pairs with mean %g", counter.N, m1, jk.Total.N, m2)
+	}
+
+	jk = ReferenceCovs(pop.Genomes, 0, maxl, genome.Linear)
+	if jk.Total.N != len(pop.Genomes)-1 {
+		t.Errorf("expected %d pairs, but got %d", len(pop.Genomes)-1, jk.Total.N)
+	}
+	if mErr, _ := jk.DErr(); mErr <= 0 {
+		t.Errorf("invalid standard error %g", mErr)
+	}
+}
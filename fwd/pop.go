@@ -7,3 +7,8 @@ type Population interface {
 	GetTime() int
 	Json() []byte
 }
+
+// Resizer: a population whose size changes over the generations, as under a demography.
+type Resizer interface {
+	Resize(size int) // size of the next generations
+}
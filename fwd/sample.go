@@ -0,0 +1,164 @@
+package fwd
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// Rand: random number generator used for sampling.
+// Both SeqPop and SeqPartPop implement it with their own random sources.
+type Rand interface {
+	Intn(n int) int
+}
+
+// the random source of a population, if it implements Rand, or the global source of math/rand.
+func randOf(pop Population) Rand {
+	if rng, yes := pop.(Rand); yes {
+		return rng
+	}
+	return globalRand{}
+}
+
+type globalRand struct{}
+
+func (globalRand) Intn(n int) int {
+	return rand.Intn(n)
+}
+
+// SampledGenome: a sampled genome tagged with its origin.
+type SampledGenome struct {
+	Index    int      // index of the genome in the population
+	Deme     int      // deme of the genome (0 if the population is not structured)
+	Time     int      // generation when the genome was sampled
+	Sequence Sequence // a copy of the genome sequence
+}
+
+// RandomSample: returns a sample of genomes from the current population,
+// drawn with or without replacement using the population's random source, if it implements Rand.
+func RandomSample(pop Population, size int, replace bool) ([]SampledGenome, error) {
+	genomes := pop.GetGenomes()
+	idxes, err := draw(randOf(pop), len(genomes), size, replace)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := make([]SampledGenome, size)
+	for i, idx := range idxes {
+		sample[i] = newSampledGenome(genomes[idx], idx, 0, pop.GetTime())
+	}
+
+	return sample, nil
+}
+
+// StratifiedSample: returns a sample drawn separately from each deme.
+// demes[d] lists the genome indices of deme d, and sizes[d] is the number of genomes sampled from it.
+func StratifiedSample(pop Population, demes [][]int, sizes []int, replace bool) ([]SampledGenome, error) {
+	if len(demes) != len(sizes) {
+		return nil, fmt.Errorf("got %d demes but %d sample sizes", len(demes), len(sizes))
+	}
+
+	genomes := pop.GetGenomes()
+	rng := randOf(pop)
+	sample := []SampledGenome{}
+	for d, deme := range demes {
+		idxes, err := draw(rng, len(deme), sizes[d], replace)
+		if err != nil {
+			return nil, fmt.Errorf("deme %d: %v", d, err)
+		}
+		for _, i := range idxes {
+			idx := deme[i]
+			if idx < 0 || idx >= len(genomes) {
+				return nil, fmt.Errorf("deme %d: genome index %d out of range", d, idx)
+			}
+			sample = append(sample, newSampledGenome(genomes[idx], idx, d, pop.GetTime()))
+		}
+	}
+
+	return sample, nil
+}
+
+// SerialSample: evolves the population and takes a sample at each of the given generations.
+// times should be in ascending order and not earlier than the current generation.
+func SerialSample(pop Population, times []int, size int, replace bool) ([]SampledGenome, error) {
+	sample := []SampledGenome{}
+	for _, t := range times {
+		if t < pop.GetTime() {
+			return nil, fmt.Errorf("cannot sample at generation %d, population is at generation %d", t, pop.GetTime())
+		}
+		for pop.GetTime() < t {
+			pop.Evolve()
+		}
+		s, err := RandomSample(pop, size, replace)
+		if err != nil {
+			return nil, err
+		}
+		sample = append(sample, s...)
+	}
+
+	return sample, nil
+}
+
+// Window: returns the sub-window [begin, end) of each sampled genome.
+func Window(sample []SampledGenome, begin, end int) ([]SampledGenome, error) {
+	windows := make([]SampledGenome, len(sample))
+	for i, s := range sample {
+		if begin < 0 || end > len(s.Sequence) || begin >= end {
+			return nil, fmt.Errorf("window [%d, %d) is out of genome [0, %d)", begin, end, len(s.Sequence))
+		}
+		windows[i] = newSampledGenome(s.Sequence[begin:end], s.Index, s.Deme, s.Time)
+	}
+
+	return windows, nil
+}
+
+// Sequences: returns the sequences of a sample.
+func Sequences(sample []SampledGenome) []Sequence {
+	seqs := make([]Sequence, len(sample))
+	for i, s := range sample {
+		seqs[i] = s.Sequence
+	}
+
+	return seqs
+}
+
+func newSampledGenome(seq Sequence, index, deme, time int) SampledGenome {
+	s := SampledGenome{Index: index, Deme: deme, Time: time}
+	s.Sequence = make(Sequence, len(seq))
+	copy(s.Sequence, seq)
+	return s
+}
+
+// draw size indexes from [0, n).
+func draw(rng Rand, n, size int, replace bool) ([]int, error) {
+	if size < 0 {
+		return nil, errors.New("sample size should not be negative")
+	}
+
+	idxes := make([]int, size)
+	if replace {
+		if size > 0 && n <= 0 {
+			return nil, errors.New("cannot sample from an empty population")
+		}
+		for i := range idxes {
+			idxes[i] = rng.Intn(n)
+		}
+		return idxes, nil
+	}
+
+	if size > n {
+		return nil, fmt.Errorf("sample size %d exceeds population size %d", size, n)
+	}
+	// partial Fisher-Yates shuffle
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+	for i := 0; i < size; i++ {
+		j := i + rng.Intn(n-i)
+		perm[i], perm[j] = perm[j], perm[i]
+		idxes[i] = perm[i]
+	}
+
+	return idxes, nil
+}
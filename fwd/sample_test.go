@@ -0,0 +1,125 @@
+package fwd
+
+import (
+	"testing"
+)
+
+func TestRandomSample(t *testing.T) {
+	pop := NewSeqPartPop(10, 50, 1e-3, 0, 0)
+	pop.Seed(1)
+
+	sample, err := RandomSample(pop, 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[int]bool)
+	for _, s := range sample {
+		if seen[s.Index] {
+			t.Errorf("genome %d was sampled twice without replacement", s.Index)
+		}
+		seen[s.Index] = true
+	}
+
+	if _, err := RandomSample(pop, 11, false); err == nil {
+		t.Error("expected an error when sample size exceeds population size")
+	}
+
+	sample, err = RandomSample(pop, 100, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sample) != 100 {
+		t.Errorf("expected 100 genomes, but got %d", len(sample))
+	}
+}
+
+func TestStratifiedSample(t *testing.T) {
+	pop := NewSeqPartPop(10, 50, 1e-3, 0, 0)
+	pop.Seed(1)
+	demes := [][]int{{0, 1, 2, 3, 4}, {5, 6, 7, 8, 9}}
+
+	sample, err := StratifiedSample(pop, demes, []int{2, 3}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sample) != 5 {
+		t.Fatalf("expected 5 genomes, but got %d", len(sample))
+	}
+	for _, s := range sample {
+		if s.Index/5 != s.Deme {
+			t.Errorf("genome %d is tagged with deme %d", s.Index, s.Deme)
+		}
+	}
+
+	if _, err := StratifiedSample(pop, demes, []int{2, 6}, false); err == nil {
+		t.Error("expected an error when sample size exceeds deme size")
+	}
+}
+
+func TestSerialSample(t *testing.T) {
+	pop := NewSeqPartPop(10, 50, 1e-3, 1e-3, 10)
+	pop.Seed(1)
+
+	sample, err := SerialSample(pop, []int{0, 5, 20}, 3, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	times := []int{0, 0, 0, 5, 5, 5, 20, 20, 20}
+	for i, s := range sample {
+		if s.Time != times[i] {
+			t.Errorf("genome %d: expected time %d, but got %d", i, times[i], s.Time)
+		}
+	}
+
+	if _, err := SerialSample(pop, []int{10}, 3, false); err == nil {
+		t.Error("expected an error when sampling in the past")
+	}
+}
+
+func TestWindow(t *testing.T) {
+	pop := NewSeqPartPop(10, 50, 1e-3, 0, 0)
+	pop.Seed(1)
+	sample, err := RandomSample(pop, 3, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	windows, err := Window(sample, 10, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, w := range windows {
+		if len(w.Sequence) != 10 {
+			t.Errorf("expected window length 10, but got %d", len(w.Sequence))
+		}
+		if string(w.Sequence) != string(sample[i].Sequence[10:20]) {
+			t.Errorf("window %d does not match the genome", i)
+		}
+	}
+
+	if _, err := Window(sample, 40, 60); err == nil {
+		t.Error("expected an error for a window out of the genome")
+	}
+}
+
+// a population of another package, without its own random source
+type staticPop struct {
+	genomes []Sequence
+}
+
+func (p *staticPop) Evolve()                {}
+func (p *staticPop) GetGenomes() []Sequence { return p.genomes }
+func (p *staticPop) GetLength() int         { return len(p.genomes[0]) }
+func (p *staticPop) GetTime() int           { return 0 }
+func (p *staticPop) Json() []byte           { return nil }
+
+func TestSampleWithoutRand(t *testing.T) {
+	pop := &staticPop{genomes: []Sequence{Sequence("AA"), Sequence("AC"), Sequence("CC")}}
+	sample, err := RandomSample(pop, 3, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sample) != 3 || sample[0].Index == sample[1].Index {
+		t.Errorf("expected 3 distinct genomes, but got %v", sample)
+	}
+}
@@ -3,6 +3,7 @@ package fwd
 import (
 	"encoding/json"
 	"github.com/mingzhi/gomath/random"
+	"github.com/mingzhi/hgt/genome"
 	"log"
 	"math/rand"
 	"time"
@@ -18,6 +19,8 @@ type SeqPartPop struct {
 	Transfer  float64    // transfer rate
 	Genomes   []Sequence // genomes
 
+	Topology genome.Topology // genome topology, linear by default
+
 	states string // nucleotide characters
 
 	// random variables
@@ -40,6 +43,7 @@ func NewSeqPartPop(size, length int, mutation, transfer float64, fragment int) *
 		Mutation: mutation,
 		Transfer: transfer,
 		Fragment: fragment,
+		Topology: genome.Linear,
 	}
 
 	// create random sources
@@ -50,10 +54,10 @@ func NewSeqPartPop(size, length int, mutation, transfer float64, fragment int) *
 	// determin poisson lambda (expected mean)
 	// mutation events and transfer events are independent poisson distribution.
 	// therefore, the total number of events are also following poission distrubtion
-	// with mean = (u + r) * (P+F) * N, where P is the partial length of a genome.
-	// mutation events: u * l * N, transfer events: r * (l + f) * N
-	mean := float64(pop.Size) * (pop.Mutation*float64(pop.Length) + pop.Transfer*float64(pop.Length+pop.Fragment))
-	pop.pois = random.NewPoisson(mean, pop.src)
+	// with mean = (u * P + r * S) * N, where P is the partial length of a genome
+	// and S the number of positions where a fragment can begin, P+F-1 on a linear genome.
+	// mutation events: u * P * N, transfer events: r * S * N
+	pop.setPoisson()
 
 	// create genomes (partial length)
 	// randomly create a parent sequence
@@ -82,6 +86,65 @@ func (pop *SeqPartPop) Evolve() {
 	pop.NumOfGens++
 }
 
+// set seed
+func (pop *SeqPartPop) Seed(seed int) {
+	pop.src.Seed(int64(seed))
+}
+
+// GetGenomes: return genome sequences
+func (pop *SeqPartPop) GetGenomes() []Sequence {
+	return pop.Genomes
+}
+
+// GetLength: return genome length
+func (pop *SeqPartPop) GetLength() int {
+	return pop.Length
+}
+
+// GetTime: return evolved time
+func (pop *SeqPartPop) GetTime() int {
+	return pop.NumOfGens
+}
+
+// Intn: return a random integer in [0, n) from the population's random source
+func (pop *SeqPartPop) Intn(n int) int {
+	return pop.rng.Intn(n)
+}
+
+// Resize: set the size of the next generations,
+// whose parents are drawn from the current genomes
+func (pop *SeqPartPop) Resize(size int) {
+	if size <= 0 {
+		log.Panic("Population size should be positive!")
+	}
+	if size != pop.Size {
+		pop.Size = size
+		pop.setPoisson()
+	}
+}
+
+// SetTopology: set the genome topology.
+// Fragments begin at the positions genome.Topology.Starts returns, at the transfer rate each:
+// on a linear genome, the partial genome is a window of a longer genome,
+// and fragments starting before or running beyond the window are truncated;
+// on a circular genome, fragments start in the genome and wrap around the end.
+func (pop *SeqPartPop) SetTopology(t genome.Topology) {
+	pop.Topology = t
+	pop.setPoisson()
+}
+
+// the number of positions where a transferred fragment can begin
+func (pop *SeqPartPop) transferSites() int {
+	lo, hi := pop.Topology.Starts(pop.Fragment, pop.Length)
+	return hi - lo
+}
+
+// set the poisson sampling of the number of events per generation
+func (pop *SeqPartPop) setPoisson() {
+	mean := float64(pop.Size) * (pop.Mutation*float64(pop.Length) + pop.Transfer*float64(pop.transferSites()))
+	pop.pois = random.NewPoisson(mean, pop.src)
+}
+
 // Json: return the entire population in JSON format
 func (pop *SeqPartPop) Json() []byte {
 	b, err := json.Marshal(pop)
@@ -95,10 +158,10 @@ func (pop *SeqPartPop) Json() []byte {
 // Wright-Fisher generation
 func (pop *SeqPartPop) reproduce() {
 	newGenomes := make([]Sequence, pop.Size)
-	used := make([]bool, pop.Size)  // records used genomes
-	for n := 0; n < pop.Size; n++ { // n is new genome index
-		o := pop.rng.Intn(pop.Size) // randomly generate a old genome index
-		if used[o] {                // this old genome has been reassigned
+	used := make([]bool, len(pop.Genomes)) // records used genomes
+	for n := 0; n < pop.Size; n++ {        // n is new genome index
+		o := pop.rng.Intn(len(pop.Genomes)) // randomly generate a old genome index
+		if used[o] {                        // this old genome has been reassigned
 			// do hard copy
 			newGenomes[n] = make(Sequence, pop.Length)
 			copy(newGenomes[n], pop.Genomes[o])
@@ -122,9 +185,9 @@ func (pop *SeqPartPop) manipulate() {
 	for i := 0; i < k; i++ {
 		// determine whether this event is a mutation or transfer by flipping a coin
 		// lambda = (mu * length) / ((mu * length) * (tr * (length + fragment)))
-		pmu := pop.Mutation * float64(pop.Length)              // proportion of mutation events
-		ptr := pop.Transfer * float64(pop.Length+pop.Fragment) // proportion of transfer events
-		lambda := pmu / (pmu + ptr)                            // ratio of mutation and transfer events
+		pmu := pop.Mutation * float64(pop.Length)          // proportion of mutation events
+		ptr := pop.Transfer * float64(pop.transferSites()) // proportion of transfer events
+		lambda := pmu / (pmu + ptr)                        // ratio of mutation and transfer events
 		r := pop.rng.Float64()
 		if r < lambda {
 			pop.mutate()
@@ -155,28 +218,12 @@ func (pop *SeqPartPop) transfer() {
 		d = pop.rng.Intn(pop.Size)
 	}
 
-	// choose a start position
-	l := pop.rng.Intn(pop.Length+pop.Fragment) - pop.Fragment
-
-	// determin the boundaries
-	// begin of the transferred fragment
-	begin := 0
-	if l < 0 {
-		begin = 0
-	} else {
-		begin = l
-	}
-
-	// end of the transferred fragment
-	end := pop.Length
-	if l+pop.Fragment < pop.Length {
-		end = l + pop.Fragment
-	} else {
-		end = pop.Length
-	}
+	// choose a start position, before the window on a linear genome
+	lo, _ := pop.Topology.Starts(pop.Fragment, pop.Length)
+	l := lo + pop.rng.Intn(pop.transferSites())
 
 	// do the transfer
-	for i := begin; i < end; i++ {
-		pop.Genomes[g][i] = pop.Genomes[d][i]
+	for _, t := range pop.Topology.Tract(l, pop.Fragment, pop.Length) {
+		copy(pop.Genomes[g][t[0]:t[1]], pop.Genomes[d][t[0]:t[1]])
 	}
 }
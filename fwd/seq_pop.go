@@ -3,6 +3,7 @@ package fwd
 import (
 	"bitbucket.org/mingzhi/gsl/randist"
 	"encoding/json"
+	"github.com/mingzhi/hgt/genome"
 	"log"
 )
 
@@ -14,6 +15,8 @@ type SeqPop struct {
 	Transfer float64 // transfer rate
 	Fragment int     // transferred fragment length
 
+	Topology genome.Topology // genome topology, circular by default
+
 	Genomes []Sequence // genomes
 
 	NumOfGens int  // number of generations
@@ -78,6 +81,20 @@ func (s *SeqPop) SetExpTime(b bool) {
 	s.ExpTime = b
 }
 
+// SetTopology: set the genome topology.
+// Fragments begin at the positions genome.Topology.Starts returns, at the transfer rate each:
+// on a circular genome, they begin at the sites and wrap around the end;
+// a linear genome is a window of a longer genome, and fragments running over its ends are truncated.
+func (s *SeqPop) SetTopology(t genome.Topology) {
+	s.Topology = t
+}
+
+// the number of positions where a transferred fragment can begin
+func (pop *SeqPop) transferSites() int {
+	lo, hi := pop.Topology.Starts(pop.Fragment, pop.Length)
+	return hi - lo
+}
+
 // Evolve: do one generation of population evolution, which includes:
 // 1. Wright-Fisher reproduction
 // 2. Mutation
@@ -103,6 +120,20 @@ func (pop *SeqPop) GetTime() int {
 	return pop.NumOfGens
 }
 
+// Intn: return a random integer in [0, n) from the population's random source
+func (pop *SeqPop) Intn(n int) int {
+	return randist.UniformRandomInt(pop.rng, n)
+}
+
+// Resize: set the size of the next generations,
+// whose parents are drawn from the current genomes
+func (pop *SeqPop) Resize(size int) {
+	if size <= 0 {
+		log.Panic("Population size should be positive!")
+	}
+	pop.Size = size
+}
+
 // Json: return the entire population in JSON format
 func (pop *SeqPop) Json() []byte {
 	b, err := json.Marshal(pop)
@@ -116,9 +147,9 @@ func (pop *SeqPop) Json() []byte {
 // Wright-Fisher generation
 func (pop *SeqPop) reproduce() {
 	newGenomes := make([]Sequence, pop.Size)
-	used := make([]bool, pop.Size) // records used genomes
+	used := make([]bool, len(pop.Genomes)) // records used genomes
 	for n := 0; n < pop.Size; n++ {
-		o := randist.UniformRandomInt(pop.rng, pop.Size) // randomly select a parent
+		o := randist.UniformRandomInt(pop.rng, len(pop.Genomes)) // randomly select a parent
 		if used[o] {
 			// do hard copy
 			newGenomes[n] = make(Sequence, pop.Length)
@@ -137,7 +168,9 @@ func (pop *SeqPop) reproduce() {
 // evolutionary operators: mutation and transfer
 func (pop *SeqPop) manipulate() {
 	// calculate the number of events, which is poisson distribution
-	lambda := float64(pop.Size) * float64(pop.Length) * (pop.Mutation + pop.Transfer)
+	pmu := pop.Mutation * float64(pop.Length)          // rate of mutations per genome
+	ptr := pop.Transfer * float64(pop.transferSites()) // rate of transfers per genome
+	lambda := float64(pop.Size) * (pmu + ptr)
 	if pop.ExpTime {
 		t := randist.ExponentialRandomFloat64(pop.rng, 1.0)
 		lambda = t * lambda
@@ -147,9 +180,9 @@ func (pop *SeqPop) manipulate() {
 	// therefore, we can do k times of Bernoulli test
 	for i := 0; i < k; i++ {
 		// determine whether this event is a mutation or transfer
-		ratio := pop.Mutation / (pop.Mutation + pop.Transfer) // the ratio of mutation
-		r := randist.UniformRandomFloat64(pop.rng)            // randomly produce a probability
-		if r <= ratio {                                       // determin whether is a mutation or transfer
+		ratio := pmu / (pmu + ptr)                 // the ratio of mutation
+		r := randist.UniformRandomFloat64(pop.rng) // randomly produce a probability
+		if r <= ratio {                            // determin whether is a mutation or transfer
 			pop.mutate()
 		} else {
 			pop.transfer()
@@ -180,13 +213,9 @@ func (pop *SeqPop) transfer() {
 		d = randist.UniformRandomInt(pop.rng, pop.Size)
 	}
 
-	l := randist.UniformRandomInt(pop.rng, pop.Length) // randomly choose a left index
-	r := l + pop.Fragment                              // fragment right index
-
-	if r < pop.Length {
-		copy(pop.Genomes[g][l:r], pop.Genomes[d][l:r])
-	} else {
-		copy(pop.Genomes[g][l:pop.Length], pop.Genomes[d][l:pop.Length])
-		copy(pop.Genomes[g][0:r-pop.Length], pop.Genomes[d][0:r-pop.Length])
+	lo, hi := pop.Topology.Starts(pop.Fragment, pop.Length)
+	l := lo + randist.UniformRandomInt(pop.rng, hi-lo) // randomly choose a left index
+	for _, t := range pop.Topology.Tract(l, pop.Fragment, pop.Length) {
+		copy(pop.Genomes[g][t[0]:t[1]], pop.Genomes[d][t[0]:t[1]])
 	}
 }
@@ -2,123 +2,60 @@ package fwd
 
 import (
 	"fmt"
-	"github.com/mingzhi/gomath/stat/desc"
 	"github.com/mingzhi/hgt/covs"
-	"math"
+	"github.com/mingzhi/hgt/simtest"
 	"testing"
 )
 
+// the KS of independent populations at equilibrium, after 10 * size generations, should be CalculateKS.
 func TestEvolve(t *testing.T) {
-	// population parameter
-	var (
-		numofgens, samplesize  int
-		size, length, fragment int
-		mutation, transfer     float64
-		pop                    *SeqPop
-		ksmean                 *desc.Mean
-		ksvar                  *desc.Variance
-		expectedKS, tolerance  float64
-	)
-	samplesize = 100
-	size = 1000
-	length = 1000
-	mutation = 1e-4
-	fragment = 100
-	fmt.Println("--Population parameters:")
-	fmt.Printf("---Size: %d\n", size)
-	fmt.Printf("---Genome Length: %d\n", length)
-	fmt.Printf("---Mutation rate: %g\n", mutation)
-	fmt.Printf("---Transferred fragment: %d\n", fragment)
-
-	fmt.Println("--Test no horizontal transfer")
-	transfer = 0
-	pop = NewSeqPop(size, length, mutation, transfer, fragment)
-	ksmean = desc.NewMean()
-	ksvar = desc.NewVariance()
-	numofgens = 100
-	for {
-		for i := 0; i < numofgens; i++ {
-			pop.Evolve()
-			sample := Sample(pop.Genomes, samplesize)
-			dmatrix := GenerateDistanceMatrix(sample)
-			cmatrix := covs.NewCMatrix(samplesize, length, dmatrix)
-			ks, _ := cmatrix.D()
-			ksmean.Increment(ks)
-			ksvar.Increment(ks)
-		}
-		expectedKS = covs.CalculateKS(size, mutation, transfer, fragment, 4)
-		tolerance = math.Sqrt(ksvar.GetResult())
-		if math.Abs(ksmean.GetResult()-expectedKS) > tolerance {
-			if numofgens < 10000 {
-				numofgens *= 10
-				fmt.Printf("try %d generation again ...\n", numofgens)
-			} else {
-				t.Errorf("ks = %g, with tolerance = %g, expect %g\n", ksmean.GetResult(), tolerance, expectedKS)
-			}
-		} else {
-			break
-		}
+	size, length, fragment, samplesize := 1000, 1000, 100, 100
+	mutation := 1e-4
+	replicates := 20
+	if testing.Short() {
+		replicates = 5
 	}
 
-	fmt.Println("--Test horizontal transfer with same rate as mutation")
-	transfer = mutation
-	pop = NewSeqPop(size, length, mutation, transfer, fragment)
-	ksmean = desc.NewMean()
-	ksvar = desc.NewVariance()
-	numofgens = 100
-	for {
-		for i := 0; i < numofgens; i++ {
-			pop.Evolve()
-			sample := Sample(pop.Genomes, samplesize)
-			dmatrix := GenerateDistanceMatrix(sample)
-			cmatrix := covs.NewCMatrix(samplesize, length, dmatrix)
-			ks, _ := cmatrix.D()
-			ksmean.Increment(ks)
-			ksvar.Increment(ks)
-		}
-		expectedKS = covs.CalculateKS(size, mutation, transfer, fragment, 4)
-		tolerance = math.Sqrt(ksvar.GetResult())
-		if math.Abs(ksmean.GetResult()-expectedKS) > tolerance {
-			if numofgens < 10000 {
-				numofgens *= 10
-				fmt.Printf("try %d generation again ...\n", numofgens)
-			} else {
-				t.Errorf("ks = %g, with tolerance = %g, expect %g\n", ksmean.GetResult(), tolerance, expectedKS)
+	seed := simtest.Seed(t)
+	f := simtest.NewFamily(t, 1e-3)
+	for _, c := range []struct {
+		transfer float64
+		expected float64
+	}{
+		{0, covs.CalculateKS(size, mutation, 0, fragment, 4)},
+		{mutation, covs.CalculateKS(size, mutation, mutation, fragment, 4)},
+		// two genomes also coalesce at a site when one copies it from the other,
+		// at rate 2 * transfer * fragment / (size - 1) per generation, which CalculateKS misses:
+		// with transfer * fragment about 1, KS is that of the effective size under this rate,
+		// about 0.062 where CalculateKS is 0.078.
+		{mutation * 100, transferredKS(size, mutation, mutation*100, fragment)},
+	} {
+		transfer := c.transfer
+		ks := simtest.Replicate(replicates, seed, func(seed int) float64 {
+			pop := NewSeqPop(size, length, mutation, transfer, fragment)
+			pop.Seed(seed)
+			for i := 0; i < 10*size; i++ {
+				pop.Evolve()
 			}
-		} else {
-			break
-		}
-	}
-
-	fmt.Println("--Test horizontal transfer with 100 times of mutation rate")
-	transfer = mutation * 100.0
-	pop = NewSeqPop(size, length, mutation, transfer, fragment)
-	ksmean = desc.NewMean()
-	ksvar = desc.NewVariance()
-	numofgens = 100
-	for {
-		for i := 0; i < numofgens; i++ {
-			pop.Evolve()
-			sample := Sample(pop.Genomes, samplesize)
-			dmatrix := GenerateDistanceMatrix(sample)
-			cmatrix := covs.NewCMatrix(samplesize, length, dmatrix)
-			ks, _ := cmatrix.D()
-			ksmean.Increment(ks)
-			ksvar.Increment(ks)
-		}
-		expectedKS = covs.CalculateKS(size, mutation, transfer, fragment, 4)
-		tolerance = math.Sqrt(ksvar.GetResult())
-		if math.Abs(ksmean.GetResult()-expectedKS) > tolerance {
-			if numofgens < 10000 {
-				numofgens *= 10
-				fmt.Printf("try %d generation again ...\n", numofgens)
-			} else {
-				t.Errorf("ks = %g, with tolerance = %g, expect %g\n", ksmean.GetResult(), tolerance, expectedKS)
+			sample, err := RandomSample(pop, samplesize, false)
+			if err != nil {
+				t.Fatal(err)
 			}
-		} else {
-			break
-		}
+			cmatrix := covs.NewCMatrix(samplesize, length, GenerateDistanceMatrix(Sequences(sample)))
+			ks, _ := cmatrix.D()
+			return ks
+		})
+		f.Mean(fmt.Sprintf("KS at transfer %g", transfer), ks, c.expected)
 	}
+	f.Check()
+}
+
+// the Jukes-Cantor KS of four states at the effective size of a population
+// whose genomes coalesce at a site at rate 1/size + 2 * transfer * fragment / (size - 1) per generation.
+func transferredKS(size int, mutation, transfer float64, fragment int) float64 {
+	n := float64(size)
+	theta := 2 * mutation / (1/n + 2*transfer*float64(fragment)/(n-1))
+	return theta / (1 + 4*theta/3)
 }
 
 func BenchmarkEvolve(b *testing.B) {
@@ -162,3 +99,15 @@ func BenchmarkManipulation(b *testing.B) {
 		pop.manipulate()
 	}
 }
+
+func TestResize(t *testing.T) {
+	pop := NewSeqPop(100, 50, 1e-3, 1e-3, 10)
+	pop.Seed(1)
+	for _, size := range []int{10, 200, 30} {
+		pop.Resize(size)
+		pop.Evolve()
+		if len(pop.GetGenomes()) != size {
+			t.Errorf("expected %d genomes after resizing, but got %d", size, len(pop.GetGenomes()))
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package fwd
+
+import (
+	"github.com/mingzhi/hgt/covs"
+	"github.com/mingzhi/hgt/genome"
+	"runtime"
+)
+
+// StreamCovs: count mismatches of all pairs of genomes into a covs.Counter,
+// without generating the distance matrix.
+// Pairs are generated on the fly and counted in parallel,
+// and each worker only keeps O(L + maxL) memory.
+func StreamCovs(genomes []Sequence, maxL int, topology genome.Topology) *covs.Counter {
+	length := 0
+	if len(genomes) > 0 {
+		length = len(genomes[0])
+	}
+
+	// each job is the first genome of a group of pairs (i, j), j > i.
+	jobs := make(chan int)
+	go func() {
+		for i := 0; i < len(genomes); i++ {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	ncpu := runtime.GOMAXPROCS(0)
+	ch := make(chan *covs.Counter)
+	for w := 0; w < ncpu; w++ {
+		go func() {
+			c := covs.NewCounter(length, maxL, topology)
+			ds := make([]int, 0, length) // buffer of mismatch positions
+			for i := range jobs {
+				for j := i + 1; j < len(genomes); j++ {
+					ds = mismatches(genomes[i], genomes[j], ds[:0])
+					c.Add(ds)
+				}
+			}
+			ch <- c
+		}()
+	}
+
+	// collect results
+	total := covs.NewCounter(length, maxL, topology)
+	for w := 0; w < ncpu; w++ {
+		total.Merge(<-ch)
+	}
+
+	return total
+}
+
+// append mismatch positions of two sequences to ds, in ascending order.
+func mismatches(a, b Sequence, ds []int) []int {
+	for k := 0; k < len(a); k++ {
+		if a[k] != b[k] {
+			ds = append(ds, k)
+		}
+	}
+	return ds
+}
@@ -0,0 +1,40 @@
+package fwd
+
+import (
+	"github.com/mingzhi/hgt/covs"
+	"github.com/mingzhi/hgt/genome"
+	"math"
+	"testing"
+)
+
+func TestStreamCovs(t *testing.T) {
+	pop := NewSeqPartPop(50, 500, 1e-3, 1e-3, 50)
+	pop.Seed(1)
+	for i := 0; i < 50; i++ {
+		pop.Evolve()
+	}
+
+	maxl := 50
+	dmatrix := GenerateDistanceMatrix(pop.Genomes)
+	for _, topology := range []genome.Topology{genome.Linear, genome.Circular} {
+		cmatrix := covs.NewCMatrix(len(dmatrix), pop.Length, dmatrix)
+		counter := StreamCovs(pop.Genomes, maxl, topology)
+		if counter.N != len(dmatrix) {
+			t.Errorf("expected %d pairs, but got %d", len(dmatrix), counter.N)
+		}
+
+		m1, v1 := cmatrix.D()
+		m2, v2 := counter.D()
+		if math.Abs(m1-m2) > 1e-12 || math.Abs(v1-v2) > 1e-12 {
+			t.Errorf("D: expected (%g, %g), but got (%g, %g)", m1, v1, m2, v2)
+		}
+
+		scovs1, _, _, _, _ := cmatrix.CovTopology(maxl, topology)
+		scovs2, _, _, _, _ := counter.Cov()
+		for l := 0; l < maxl; l++ {
+			if scovs1[l] != scovs2[l] {
+				t.Errorf("%v, %d: expected scov %g, but got %g", topology, l, scovs1[l], scovs2[l])
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package fwd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Nucleotides: characters of the states 0-3 of SeqPop genomes,
+// the same mapping as coals.NucleicAcids.
+const Nucleotides = "ATGC"
+
+// Nucleotide: return the upper case character of a genome state.
+// States 0-3 are mapped by Nucleotides, characters are turned into upper case.
+func Nucleotide(s byte) byte {
+	if int(s) < len(Nucleotides) {
+		return Nucleotides[s]
+	}
+	if s >= 'a' && s <= 'z' {
+		return s - 'a' + 'A'
+	}
+	return s
+}
+
+// String: return the sequence in nucleotide characters.
+func (s Sequence) String() string {
+	b := make([]byte, len(s))
+	for i, c := range s {
+		b[i] = Nucleotide(c)
+	}
+	return string(b)
+}
+
+// default names of genomes: genome_0, genome_1, ...
+func genomeNames(names []string, n int) ([]string, error) {
+	if names == nil {
+		names = make([]string, n)
+		for i := range names {
+			names[i] = fmt.Sprintf("genome_%d", i)
+		}
+	}
+	if len(names) != n {
+		return nil, fmt.Errorf("got %d names for %d genomes", len(names), n)
+	}
+	return names, nil
+}
+
+// check all sequences have the same length.
+func alignmentLength(seqs []Sequence) (int, error) {
+	if len(seqs) == 0 {
+		return 0, nil
+	}
+	length := len(seqs[0])
+	for i, seq := range seqs {
+		if len(seq) != length {
+			return 0, fmt.Errorf("genome %d has length %d, expected %d", i, len(seq), length)
+		}
+	}
+	return length, nil
+}
+
+// WriteFasta: write genomes in FASTA format.
+// names can be nil, then genomes are named genome_0, genome_1, ...
+func WriteFasta(w io.Writer, names []string, seqs []Sequence) error {
+	names, err := genomeNames(names, len(seqs))
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	for i, seq := range seqs {
+		fmt.Fprintf(bw, ">%s\n%s\n", names[i], seq)
+	}
+	return bw.Flush()
+}
+
+// WritePhylip: write aligned genomes in relaxed (sequential) PHYLIP format,
+// in which names can be longer than 10 characters.
+func WritePhylip(w io.Writer, names []string, seqs []Sequence) error {
+	names, err := genomeNames(names, len(seqs))
+	if err != nil {
+		return err
+	}
+	length, err := alignmentLength(seqs)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%d %d\n", len(seqs), length)
+	for i, seq := range seqs {
+		fmt.Fprintf(bw, "%s %s\n", names[i], seq)
+	}
+	return bw.Flush()
+}
+
+// WriteNexus: write aligned genomes as a Nexus DATA block.
+func WriteNexus(w io.Writer, names []string, seqs []Sequence) error {
+	names, err := genomeNames(names, len(seqs))
+	if err != nil {
+		return err
+	}
+	length, err := alignmentLength(seqs)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#NEXUS")
+	fmt.Fprintln(bw, "BEGIN DATA;")
+	fmt.Fprintf(bw, "\tDIMENSIONS NTAX=%d NCHAR=%d;\n", len(seqs), length)
+	fmt.Fprintln(bw, "\tFORMAT DATATYPE=DNA MISSING=? GAP=-;")
+	fmt.Fprintln(bw, "\tMATRIX")
+	for i, seq := range seqs {
+		fmt.Fprintf(bw, "\t\t%s %s\n", names[i], seq)
+	}
+	fmt.Fprintln(bw, "\t;")
+	fmt.Fprintln(bw, "END;")
+	return bw.Flush()
+}
+
+// WriteVCF: write the variable sites of aligned genomes in VCF 4.2 with haploid genotypes.
+// Alleles are compared with the reference sequence ref;
+// if ref is nil, the most common allele of each site is the reference allele.
+// The chromosome is named "1", and positions are 1-based.
+func WriteVCF(w io.Writer, names []string, seqs []Sequence, ref Sequence) error {
+	names, err := genomeNames(names, len(seqs))
+	if err != nil {
+		return err
+	}
+	length, err := alignmentLength(seqs)
+	if err != nil {
+		return err
+	}
+	if ref != nil && len(ref) != length {
+		return fmt.Errorf("reference has length %d, expected %d", len(ref), length)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "##fileformat=VCFv4.2")
+	fmt.Fprintln(bw, "##source=hgt")
+	fmt.Fprintf(bw, "##contig=<ID=1,length=%d>\n", length)
+	fmt.Fprintln(bw, "##FORMAT=<ID=GT,Number=1,Type=String,Description=\"Genotype\">")
+	fmt.Fprint(bw, "#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT")
+	for _, name := range names {
+		fmt.Fprintf(bw, "\t%s", name)
+	}
+	fmt.Fprintln(bw)
+
+	for k := 0; k < length; k++ {
+		// alleles of the site, the reference allele first
+		alleles := []byte{}
+		counts := []int{}
+		if ref != nil {
+			alleles = append(alleles, Nucleotide(ref[k]))
+			counts = append(counts, 0)
+		}
+		genotypes := make([]int, len(seqs))
+		for i, seq := range seqs {
+			a := Nucleotide(seq[k])
+			idx := -1
+			for j, b := range alleles {
+				if a == b {
+					idx = j
+					break
+				}
+			}
+			if idx < 0 {
+				alleles = append(alleles, a)
+				counts = append(counts, 0)
+				idx = len(alleles) - 1
+			}
+			counts[idx]++
+			genotypes[i] = idx
+		}
+		if len(alleles) < 2 {
+			continue
+		}
+		if ref == nil {
+			// use the most common allele as the reference
+			major := 0
+			for j, c := range counts {
+				if c > counts[major] {
+					major = j
+				}
+			}
+			alleles[0], alleles[major] = alleles[major], alleles[0]
+			for i, g := range genotypes {
+				if g == 0 {
+					genotypes[i] = major
+				} else if g == major {
+					genotypes[i] = 0
+				}
+			}
+		}
+
+		fmt.Fprintf(bw, "1\t%d\t.\t%c\t", k+1, alleles[0])
+		for j, a := range alleles[1:] {
+			if j > 0 {
+				fmt.Fprint(bw, ",")
+			}
+			fmt.Fprintf(bw, "%c", a)
+		}
+		fmt.Fprint(bw, "\t.\tPASS\t.\tGT")
+		for _, g := range genotypes {
+			fmt.Fprintf(bw, "\t%d", g)
+		}
+		fmt.Fprintln(bw)
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,76 @@
+package fwd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteFormats(t *testing.T) {
+	seqs := []Sequence{{0, 1, 2, 3}, {0, 1, 2, 0}, {0, 2, 2, 0}}
+	names := []string{"a", "b", "c"}
+
+	var buf bytes.Buffer
+	if err := WriteFasta(&buf, names, seqs); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != ">a\nATGC\n>b\nATGA\n>c\nAGGA\n" {
+		t.Errorf("unexpected FASTA:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := WritePhylip(&buf, names, seqs); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "3 4\na ATGC\nb ATGA\nc AGGA\n" {
+		t.Errorf("unexpected PHYLIP:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteNexus(&buf, nil, seqs); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("NTAX=3 NCHAR=4")) || !bytes.Contains(buf.Bytes(), []byte("genome_2 AGGA")) {
+		t.Errorf("unexpected Nexus:\n%s", buf.String())
+	}
+
+	if err := WritePhylip(&buf, nil, []Sequence{{0, 1}, {0}}); err == nil {
+		t.Error("expected an error for unaligned genomes")
+	}
+}
+
+func TestWriteVCF(t *testing.T) {
+	seqs := []Sequence{Sequence("atgc"), Sequence("atga"), Sequence("agga")}
+
+	var buf bytes.Buffer
+	if err := WriteVCF(&buf, nil, seqs, nil); err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	records := []string{}
+	for _, line := range lines {
+		if line[0] != '#' {
+			records = append(records, string(line))
+		}
+	}
+	expected := []string{
+		"1\t2\t.\tT\tG\t.\tPASS\t.\tGT\t0\t0\t1",
+		"1\t4\t.\tA\tC\t.\tPASS\t.\tGT\t1\t0\t0",
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records, but got %d:\n%s", len(expected), len(records), buf.String())
+	}
+	for i := range expected {
+		if records[i] != expected[i] {
+			t.Errorf("expected record %q, but got %q", expected[i], records[i])
+		}
+	}
+
+	// with a reference, a site where all genomes differ from it is variable
+	buf.Reset()
+	if err := WriteVCF(&buf, nil, seqs, Sequence("TTGA")); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("1\t1\t.\tT\tA\t.\tPASS\t.\tGT\t1\t1\t1")) {
+		t.Errorf("unexpected VCF:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,82 @@
+// Package genome holds the genome topology shared by the simulators (fwd, coals)
+// and the analysis (covs, popgen), so that the simulators need not import the analysis.
+package genome
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Topology: the shape of the genomes, shared by the simulators and the analysis,
+// so that transferred fragments and distances between sites agree.
+// The zero value is Circular, the topology of SeqPop and of the coalescent.
+type Topology int
+
+const (
+	Circular Topology = iota // fragments wrap around the end, and distances go both ways around
+	Linear                   // fragments are truncated at the ends, and distances go one way
+)
+
+func (t Topology) String() string {
+	if t == Linear {
+		return "linear"
+	}
+	return "circular"
+}
+
+// ParseTopology returns the topology of a name, "circular" or "linear".
+func ParseTopology(name string) (Topology, error) {
+	switch strings.ToLower(name) {
+	case "circular", "circle":
+		return Circular, nil
+	case "linear":
+		return Linear, nil
+	}
+	return Circular, fmt.Errorf("unknown genome topology: %s", name)
+}
+
+// Starts returns the positions [lo, hi) where the simulators begin fragments of size sites,
+// uniformly, in a genome of length sites, at a transfer rate per position.
+// On a circular genome they are the sites of the genome.
+// A linear genome is a window of a longer genome: fragments begin at the positions of all the fragments
+// overlapping the window, some before its first site, and are truncated by Tract.
+// Either way, every site is covered by fragments beginning at size positions, at the same rate.
+func (t Topology) Starts(size, length int) (lo, hi int) {
+	if t == Circular {
+		return 0, length
+	}
+	if size < 1 {
+		size = 1
+	}
+	return 1 - size, length
+}
+
+// Tract returns the sites of a fragment of size sites, beginning at begin, in a genome of length sites,
+// as half-open intervals [b, e) in order of the fragment.
+// On a circular genome it wraps around the end, and covers at most the whole genome;
+// on a linear genome it is truncated at both ends, so begin can be negative.
+func (t Topology) Tract(begin, size, length int) (intervals [][2]int) {
+	if t == Circular {
+		if size > length {
+			size = length
+		}
+		begin = ((begin % length) + length) % length
+		end := begin + size
+		if end <= length {
+			return [][2]int{{begin, end}}
+		}
+		return [][2]int{{begin, length}, {0, end - length}}
+	}
+
+	end := begin + size
+	if begin < 0 {
+		begin = 0
+	}
+	if end > length {
+		end = length
+	}
+	if begin < end {
+		intervals = append(intervals, [2]int{begin, end})
+	}
+	return
+}
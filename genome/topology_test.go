@@ -0,0 +1,63 @@
+package genome
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTract(t *testing.T) {
+	cases := []struct {
+		topology            Topology
+		begin, size, length int
+		expected            string
+	}{
+		{Circular, 2, 3, 10, "[[2 5]]"},
+		{Circular, 8, 5, 10, "[[8 10] [0 3]]"},
+		{Circular, 4, 20, 10, "[[4 10] [0 4]]"},
+		{Linear, 2, 3, 10, "[[2 5]]"},
+		{Linear, 8, 5, 10, "[[8 10]]"},
+		{Linear, -2, 5, 10, "[[0 3]]"},
+		{Linear, -5, 5, 10, "[]"},
+	}
+	for _, c := range cases {
+		if got := fmt.Sprint(c.topology.Tract(c.begin, c.size, c.length)); got != c.expected {
+			t.Errorf("%v tract of %d sites at %d: expected %s, but got %s", c.topology, c.size, c.begin, c.expected, got)
+		}
+	}
+}
+
+func TestStarts(t *testing.T) {
+	// every site is covered by fragments beginning at size positions
+	size, length := 4, 10
+	for _, topology := range []Topology{Circular, Linear} {
+		lo, hi := topology.Starts(size, length)
+		covered := make([]int, length)
+		for begin := lo; begin < hi; begin++ {
+			tract := topology.Tract(begin, size, length)
+			if len(tract) == 0 {
+				t.Errorf("%v: empty tract at %d", topology, begin)
+			}
+			for _, iv := range tract {
+				for x := iv[0]; x < iv[1]; x++ {
+					covered[x]++
+				}
+			}
+		}
+		for x, c := range covered {
+			if c != size {
+				t.Errorf("%v: site %d covered by %d fragments, expected %d", topology, x, c, size)
+			}
+		}
+	}
+}
+
+func TestParseTopology(t *testing.T) {
+	for _, topology := range []Topology{Circular, Linear} {
+		if parsed, err := ParseTopology(topology.String()); err != nil || parsed != topology {
+			t.Errorf("expected %v, but got %v, %v", topology, parsed, err)
+		}
+	}
+	if _, err := ParseTopology("ring"); err == nil {
+		t.Error("expected an error for an unknown topology")
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/mingzhi/hgt/coals"
+	"github.com/mingzhi/hgt/fwd"
+	"github.com/mingzhi/hgt/genome"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func runCoals(args []string) {
+	var (
+		size, length, tract int
+		mutation, transfer  float64
+		trees, tables, smc  bool
+		argStats            bool
+		arg                 string
+		load, save          string
+		model               string
+		kappa               float64
+		demography          string
+		demes               int
+		migration           float64
+		demeSamples         string
+		localTransfer       bool
+		external            float64
+		externalSize        float64
+		divergence          float64
+		serial              string
+		segregating         int
+		o                   options
+	)
+	fs := flag.NewFlagSet("coals", flag.ExitOnError)
+	fs.IntVar(&size, "size", 1000, "population size")
+	fs.IntVar(&length, "length", 1000, "genome length")
+	fs.Float64Var(&mutation, "mutation", 1e-4, "mutation rate")
+	fs.Float64Var(&transfer, "transfer", 1e-4, "transfer rate per genome")
+	fs.IntVar(&tract, "fragment", 100, "transferred fragment length")
+	fs.StringVar(&demography, "demography", "", demographyUsage+"; -size is the reference size of the coalescent time")
+	fs.IntVar(&demes, "demes", 1, "number of demes of the same size, splitting -size, in an island model; not with -demography")
+	fs.Float64Var(&migration, "migration", 1e-3, "migration rate of a lineage per generation, to other demes alike")
+	fs.StringVar(&demeSamples, "deme-samples", "", "sampled genomes of each deme separated by commas, adding up to -sample; split evenly if empty")
+	fs.BoolVar(&localTransfer, "local-transfer", false, "draw transfer donors from the deme of the receiver only")
+	fs.Float64Var(&external, "external", 0, "fraction of transfers coming from an unsampled source population, in deme 1; not with -demes")
+	fs.Float64Var(&externalSize, "external-size", 1000, "population size of the external source")
+	fs.Float64Var(&divergence, "divergence", 10000, "generations ago when the external source split from the sampled population")
+	fs.StringVar(&serial, "serial", "", "serially sampled groups gens:count separated by commas, e.g. 0:10,500:10, overriding -sample; sampling times are written into <out>_times.txt")
+	fs.IntVar(&segregating, "segregating", 0, "place exactly this number of segregating sites on the history instead of mutating at -mutation, if positive; the realized theta is written into <out>_theta.txt")
+	fs.StringVar(&model, "model", "jc", "substitution model (jc or k80)")
+	fs.Float64Var(&kappa, "kappa", 2.0, "transition/transversion ratio of k80")
+	fs.StringVar(&load, "load", "", "load the parameters and history saved in this file instead of simulating a history; -mutation, if given, overrides the saved rate")
+	fs.StringVar(&save, "save", "", "save the parameters and history into this file")
+	fs.BoolVar(&smc, "smc", false, "walk along the genome in the sequentially Markov coalescent (SMC′), each local tree coming from the previous one by cutting a branch where a tract begins and re-coalescing it, instead of building the full history, for long genomes; not with -demography, -demes, -external, -serial, -segregating, -load, -save, -arg-stats, -tables or -arg")
+	fs.BoolVar(&trees, "trees", false, "write local trees into <out>_trees.txt")
+	fs.BoolVar(&argStats, "arg-stats", false, "write summary statistics of the ancestral recombination graph into <out>_argstats.txt, the transferred tract lengths reaching the sample into <out>_tracts.txt, and the TMRCA of each site, in units of -size generations as the trees, into <out>_tmrca.txt")
+	fs.BoolVar(&tables, "tables", false, "write tskit tables into <out>_nodes.txt, <out>_edges.txt, <out>_sites.txt, <out>_mutations.txt and <out>_populations.txt")
+	fs.StringVar(&arg, "arg", "", "write the ancestral recombination graph into <out>.dot or <out>.graphml (dot or graphml)")
+	o.register(fs)
+	fs.Parse(args)
+
+	if smc {
+		if demography != "" || demes > 1 || external > 0 || serial != "" || segregating > 0 || argStats || load != "" || save != "" || tables || arg != "" {
+			log.Fatal("-smc does not support -demography, -demes, -external, -serial, -segregating, -load, -save, -arg-stats, -tables or -arg")
+		}
+		o.setTopology(genome.Circular)
+		runSMC(size, length, mutation, transfer, tract, model, kappa, trees, o)
+		return
+	}
+
+	var w *coals.WFPopulation
+	if load != "" {
+		w = loadPopulation(load)
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name == "mutation" {
+				w.MutationRate = mutation
+			}
+		})
+		o.sample = w.SampleSize
+		o.setTopology(w.Topology)
+		if o.topology != w.Topology {
+			log.Fatalf("-topology %v differs from the %v genomes of the saved history", o.topology, w.Topology)
+		}
+		w.Seed(o.seed)
+	} else {
+		var times []float64
+		if serial != "" {
+			times = parseSerial(serial, size)
+			o.sample = len(times)
+		}
+		w = coals.NewWFPopulation(size, o.sample, length, mutation, transfer, tract)
+		o.setTopology(genome.Circular)
+		w.Topology = o.topology
+		w.SampleTimes = times
+		w.Demography = parseDemography(demography)
+		if demes > 1 {
+			if demography != "" {
+				log.Fatal("-demography does not support -demes")
+			}
+			w.Structure = coals.NewIslandStructure(demes, float64(size)/float64(demes), migration, splitSamples(demeSamples, o.sample, demes))
+			w.Structure.LocalTransfer = localTransfer
+		}
+		if external > 0 {
+			if demes > 1 {
+				log.Fatal("-external does not support -demes")
+			}
+			w.External = &coals.External{Fraction: external, Size: externalSize, Divergence: divergence}
+		}
+		w.Seed(o.seed)
+		if err := w.Backtrace(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// before any output, as a history saved by an older version cannot give them
+	var stats coals.ARGStats
+	if argStats {
+		var err error
+		if stats, err = w.GetHistory().ARGStats(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	m, err := coals.ParseSubstitutionModel(model, kappa)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w.Model = m
+	var seqMap map[int][]byte
+	if segregating > 0 {
+		if segregating > w.GenomeLength {
+			log.Fatalf("-segregating %d is more than the %d sites of the genome", segregating, w.GenomeLength)
+		}
+		var theta float64
+		seqMap, theta = w.FortraceSegregating(segregating)
+		writeTheta(o.out+"_theta.txt", segregating, theta)
+	} else {
+		seqMap = w.Fortrace()
+	}
+
+	// leaves of the history are the sampled genomes 0 ... sample-1
+	sample := make([]fwd.Sequence, o.sample)
+	for i := 0; i < o.sample; i++ {
+		sample[i] = seqMap[i]
+	}
+	o.write(sample, rand.New(rand.NewSource(int64(o.seed))))
+
+	if w.SampleTimes != nil {
+		writeTimes(o.out+"_times.txt", w)
+	}
+	if save != "" {
+		savePopulation(save, w)
+	}
+	if trees {
+		writeTrees(o.out+"_trees.txt", w.LocalTrees())
+	}
+	if argStats {
+		writeARGStats(o.out, stats)
+	}
+	if tables {
+		writeTables(o.out, w.Tables())
+	}
+	if arg != "" {
+		writeARG(o.out, arg, w.GetHistory())
+	}
+}
+
+// simulate the sample in the SMC′ mode, with the local trees it walks through
+func runSMC(size, length int, mutation, transfer float64, tract int, model string, kappa float64, trees bool, o options) {
+	w := coals.NewWFPopulation(size, o.sample, length, mutation, transfer, tract)
+	w.Topology = o.topology
+	m, err := coals.ParseSubstitutionModel(model, kappa)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w.Model = m
+	w.Seed(o.seed)
+	localTrees, seqMap := w.SMC()
+
+	sample := make([]fwd.Sequence, o.sample)
+	for i := 0; i < o.sample; i++ {
+		sample[i] = seqMap[i]
+	}
+	o.write(sample, rand.New(rand.NewSource(int64(o.seed))))
+
+	if trees {
+		writeTrees(o.out+"_trees.txt", localTrees)
+	}
+}
+
+// write tskit tables in text format, to be loaded by tskit.load_text
+func writeTables(out string, t *coals.Tables) {
+	names := []string{"nodes", "edges", "sites", "mutations", "populations"}
+	files := make([]*os.File, len(names))
+	for i, name := range names {
+		f, err := os.Create(out + "_" + name + ".txt")
+		if err != nil {
+			log.Fatal(err)
+		}
+		files[i] = f
+	}
+
+	err := t.WriteText(files[0], files[1], files[2], files[3], files[4])
+	for _, f := range files {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// sampling times of serial groups gens:count, in units of size generations
+func parseSerial(s string, size int) []float64 {
+	gens := []float64{}
+	counts := []int{}
+	for _, field := range strings.Split(s, ",") {
+		values := strings.Split(strings.TrimSpace(field), ":")
+		if len(values) != 2 {
+			log.Fatalf("expected gens:count, got %q\n", field)
+		}
+		g, err := strconv.ParseFloat(values[0], 64)
+		if err != nil {
+			log.Fatal(err)
+		}
+		n, err := strconv.Atoi(values[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		gens = append(gens, g)
+		counts = append(counts, n)
+	}
+	times, err := coals.NewSerialSampleTimes(size, gens, counts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return times
+}
+
+// write the sampling time of each genome, in generations before the present
+func writeTimes(filename string, w *coals.WFPopulation) {
+	writeFile(filename, func(bw io.Writer) error {
+		for i, t := range w.SampleTimes {
+			fmt.Fprintf(bw, "genome_%d\t%g\n", i, t*float64(w.Size))
+		}
+		return nil
+	})
+}
+
+// write the number of segregating sites and the realized theta per site
+func writeTheta(filename string, segregating int, theta float64) {
+	writeFile(filename, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "segsites\t%d\ntheta\t%g\n", segregating, theta)
+		return err
+	})
+}
+
+// sampled genomes of each deme, parsed from a list or split evenly
+func splitSamples(s string, sample, demes int) []int {
+	samples := make([]int, demes)
+	if s == "" {
+		for i := range samples {
+			samples[i] = sample / demes
+			if i < sample%demes {
+				samples[i]++
+			}
+		}
+		return samples
+	}
+
+	fields := strings.Split(s, ",")
+	if len(fields) != demes {
+		log.Fatalf("expected sample sizes of %d demes, got %q\n", demes, s)
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			log.Fatal(err)
+		}
+		samples[i] = n
+	}
+	return samples
+}
+
+func loadPopulation(filename string) *coals.WFPopulation {
+	f, err := os.Open(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	w, err := coals.LoadWFPopulation(bufio.NewReader(f))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return w
+}
+
+func savePopulation(filename string, w *coals.WFPopulation) {
+	writeFile(filename, w.Save)
+}
+
+// write the ancestral recombination graph in DOT or GraphML format
+func writeARG(out, format string, h *coals.EvolutionHistory) {
+	var write func(io.Writer) error
+	switch format {
+	case "dot":
+		write = h.WriteDot
+	case "graphml":
+		write = h.WriteGraphML
+	default:
+		log.Fatalf("unknown graph format: %s\n", format)
+	}
+
+	writeFile(out+"."+format, write)
+}
+
+// write local trees, one interval per line: begin, end and the Newick tree
+func writeTrees(filename string, trees []coals.LocalTree) {
+	writeFile(filename, func(w io.Writer) error {
+		for _, tree := range trees {
+			fmt.Fprintf(w, "%d\t%d\t%s\n", tree.Begin, tree.End, tree.Newick)
+		}
+		return nil
+	})
+}
+
+// write the summary statistics of the history into <out>_argstats.txt,
+// the tract lengths into <out>_tracts.txt and the TMRCA profile into <out>_tmrca.txt
+func writeARGStats(out string, s coals.ARGStats) {
+	mean := 0.0
+	for _, l := range s.TractLengths {
+		mean += float64(l)
+	}
+	if len(s.TractLengths) > 0 {
+		mean /= float64(len(s.TractLengths))
+	}
+	writeLines(out+"_argstats.txt", []string{
+		fmt.Sprintf("transfers\t%d", s.Transfers),
+		fmt.Sprintf("tracts\t%d", len(s.TractLengths)),
+		fmt.Sprintf("mean_tract\t%g", mean),
+		fmt.Sprintf("local_trees\t%d", s.LocalTrees),
+		fmt.Sprintf("clonal\t%g", s.Clonal),
+	})
+
+	tracts := make([]string, len(s.TractLengths))
+	for i, l := range s.TractLengths {
+		tracts[i] = fmt.Sprint(l)
+	}
+	writeLines(out+"_tracts.txt", tracts)
+
+	tmrca := make([]string, len(s.TMRCA))
+	for x, t := range s.TMRCA {
+		tmrca[x] = fmt.Sprintf("%d\t%g", x, t)
+	}
+	writeLines(out+"_tmrca.txt", tmrca)
+}
+
+func writeLines(filename string, lines []string) {
+	writeFile(filename, func(w io.Writer) error {
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+		return nil
+	})
+}
+
+func runMS(args []string) {
+	p, err := coals.ParseMSArgs(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(p.Seeds) == 0 {
+		p.Seeds = []int{int(time.Now().UnixNano() % (1 << 31)), 0, 0}
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	if err := coals.MS(w, p); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"github.com/mingzhi/hgt/coals"
+	"github.com/mingzhi/hgt/fwd"
+	"github.com/mingzhi/hgt/genome"
+	"log"
+	"math"
+)
+
+// parameters of a forward simulation
+type fwdParams struct {
+	size       int              // population size
+	length     int              // genome length
+	mutation   float64          // mutation rate
+	transfer   float64          // transfer rate
+	fragment   int              // transferred fragment length
+	gens       int              // number of generations
+	demography coals.Demography // sizes over the generations, nil for a constant size
+	options
+}
+
+func parseFwd(name string, args []string) *fwdParams {
+	p := fwdParams{}
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.IntVar(&p.size, "size", 1000, "population size")
+	fs.IntVar(&p.length, "length", 1000, "genome length")
+	fs.Float64Var(&p.mutation, "mutation", 1e-4, "mutation rate")
+	fs.Float64Var(&p.transfer, "transfer", 1e-4, "transfer rate")
+	fs.IntVar(&p.fragment, "fragment", 100, "transferred fragment length")
+	fs.IntVar(&p.gens, "gens", 1000, "number of generations")
+	demography := fs.String("demography", "", demographyUsage)
+	p.register(fs)
+	fs.Parse(args)
+
+	p.demography = parseDemography(*demography)
+	if p.demography != nil {
+		// the size at the start of the simulation, gens generations ago
+		p.size = sizeAt(p.demography, float64(p.gens))
+	}
+	return &p
+}
+
+func runFwd(args []string) {
+	p := parseFwd("fwd", args)
+	pop := fwd.NewSeqPop(p.size, p.length, p.mutation, p.transfer, p.fragment)
+	p.setTopology(genome.Circular)
+	pop.SetTopology(p.topology)
+	pop.Seed(p.seed)
+	evolve(pop, p)
+}
+
+func runFwdPart(args []string) {
+	p := parseFwd("fwdpart", args)
+	pop := fwd.NewSeqPartPop(p.size, p.length, p.mutation, p.transfer, p.fragment)
+	p.setTopology(genome.Linear)
+	pop.SetTopology(p.topology)
+	pop.Seed(p.seed)
+	evolve(pop, p)
+}
+
+// a forward population drawing its samples from its own random source,
+// and resized under a demography
+type simulator interface {
+	fwd.Population
+	fwd.Rand
+	fwd.Resizer
+}
+
+// evolve a population for p.gens generations,
+// then sample and write the genomes.
+func evolve(pop simulator, p *fwdParams) {
+	for i := 0; i < p.gens; i++ {
+		if p.demography != nil {
+			// the generation born gens-1-i generations ago
+			pop.Resize(sizeAt(p.demography, float64(p.gens-1-i)))
+		}
+		pop.Evolve()
+	}
+	log.Printf("Evolved %d generations\n", pop.GetTime())
+
+	sample, err := fwd.RandomSample(pop, p.sample, false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p.write(fwd.Sequences(sample), pop)
+}
+
+const demographyUsage = "epochs start:size[:growth] separated by commas, going back in time from the present, e.g. 0:1000:0.0115,200:100 for 100 genomes growing to 1000 over the last 200 generations"
+
+// parse the demography flag, nil if it is empty
+func parseDemography(s string) coals.Demography {
+	if s == "" {
+		return nil
+	}
+	d, err := coals.ParseDemography(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return d
+}
+
+// the size of the demography t generations ago, as a number of genomes
+func sizeAt(d coals.Demography, t float64) int {
+	return int(math.Max(1, math.Floor(d.SizeAt(t)+0.5)))
+}
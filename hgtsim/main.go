@@ -0,0 +1,65 @@
+// hgtsim: run the forward and coalescent simulators from the command line.
+// usage --
+// hgtsim fwd [flags]     forward simulation of full genomes (fwd.SeqPop)
+// hgtsim fwdpart [flags] forward simulation of partial genomes (fwd.SeqPartPop)
+// hgtsim coals [flags]   coalescent simulation (coals.WFPopulation)
+// hgtsim ms [ms args]    coalescent simulation with ms arguments and output,
+// e.g. hgtsim ms nsam nreps -t theta -r rho nsites -c f lambda -seeds x1 x2 x3.
+// hgtsim validate [flags] compare replicates of fwd and coals simulations of matched parameters,
+// writing a report of two-sample tests into <out>_validate.txt.
+// the other subcommands sample genomes, write them into <out>.fasta
+// (or .phy, .nex, .vcf, according to -format),
+// and write KS, VarD and covariances into <out>_covs.txt.
+// run "hgtsim <command> -h" for the flags of each command.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// a subcommand
+type command struct {
+	name  string
+	usage string
+	run   func(args []string)
+}
+
+var commands = []command{
+	{"fwd", "forward simulation of full genomes", runFwd},
+	{"fwdpart", "forward simulation of partial genomes", runFwdPart},
+	{"coals", "coalescent simulation", runCoals},
+	{"ms", "coalescent simulation with ms arguments and output", runMS},
+	{"validate", "compare forward and coalescent simulations of matched parameters", runValidate},
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := flag.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name == name {
+			cmd.run(flag.Args()[1:])
+			return
+		}
+	}
+
+	log.Printf("unknown command: %s\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: hgtsim <command> [flags]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.usage)
+	}
+}
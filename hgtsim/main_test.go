@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// every subcommand should run on tiny parameters and write its files.
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	out := func(name string) string { return filepath.Join(dir, name) }
+	tiny := []string{"-size", "20", "-length", "50", "-fragment", "10", "-sample", "5", "-maxl", "10", "-seed", "1"}
+	cases := []struct {
+		name  string
+		run   func(args []string)
+		args  []string
+		files []string
+	}{
+		{"fwd", runFwd, []string{"-gens", "20", "-format", "phylip", "-out", out("fwd")}, []string{"fwd.phy", "fwd_covs.txt"}},
+		{"fwdpart", runFwdPart, []string{"-gens", "20", "-pairs", "4", "-out", out("fwdpart")}, []string{"fwdpart.fasta", "fwdpart_covs.txt"}},
+		{"coals", runCoals, []string{"-transfer", "1e-2", "-trees", "-tables", "-arg", "dot", "-arg-stats", "-save", out("coals.json"), "-out", out("coals")},
+			[]string{"coals.fasta", "coals_covs.txt", "coals_trees.txt", "coals_nodes.txt", "coals_edges.txt", "coals.dot", "coals_argstats.txt", "coals_tmrca.txt", "coals.json"}},
+		{"coals -load", runCoals, []string{"-load", out("coals.json"), "-format", "vcf", "-out", out("loaded")}, []string{"loaded.vcf", "loaded_covs.txt"}},
+		{"coals -smc", runCoals, []string{"-smc", "-trees", "-format", "nexus", "-out", out("smc")}, []string{"smc.nex", "smc_trees.txt"}},
+		{"coals -serial", runCoals, []string{"-serial", "0:3,10:2", "-out", out("serial")}, []string{"serial.fasta", "serial_times.txt"}},
+		{"validate", runValidate, []string{"-replicates", "3", "-gens", "20", "-step", "5", "-alpha", "0", "-out", out("validate")}, []string{"validate_validate.txt"}},
+	}
+	for _, c := range cases {
+		c.run(append(append([]string{}, tiny...), c.args...))
+		for _, name := range c.files {
+			if info, err := os.Stat(out(name)); err != nil || info.Size() == 0 {
+				t.Errorf("%s: expected a non-empty %s, got %v", c.name, name, err)
+			}
+		}
+	}
+}
+
+// ms writes to the standard output.
+func TestMSCommand(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "ms.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stdout := os.Stdout
+	os.Stdout = f
+	runMS([]string{"5", "2", "-t", "2", "-r", "1", "100", "-c", "1", "10", "-seeds", "1", "2", "3"})
+	os.Stdout = stdout
+
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(b), "//") != 2 {
+		t.Errorf("expected 2 replicates, got\n%s", b)
+	}
+}
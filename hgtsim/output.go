@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/mingzhi/hgt/covs"
+	"github.com/mingzhi/hgt/fwd"
+	"github.com/mingzhi/hgt/genome"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// options shared by all subcommands
+type options struct {
+	sample int    // sample size
+	maxl   int    // maximum distance of covariances
+	circle bool   // calculate covariances on a circular genome
+	shape  string // genome topology of the simulation and the covariances, the defaults if empty
+	seed   int    // random seed
+	out    string // output prefix
+	pairs  int    // number of random pairs used for covariances (0 for all pairs)
+	ref    int    // reference genome compared with the others (-1 for none)
+	format string // output format of sequences
+
+	topology    genome.Topology // genome topology of the simulation, set by setTopology
+	covTopology genome.Topology // genome topology of the covariances, set by setTopology
+}
+
+// register the shared options in a flag set
+func (o *options) register(fs *flag.FlagSet) {
+	fs.IntVar(&o.sample, "sample", 100, "sample size")
+	fs.IntVar(&o.maxl, "maxl", 100, "maximum distance of covariances")
+	fs.StringVar(&o.shape, "topology", "", "genome topology of both the simulation and the covariances: circular or linear (default a circular simulation, linear for fwdpart, and linear covariances)")
+	fs.BoolVar(&o.circle, "circle", false, "calculate covariances on a circular genome")
+	fs.IntVar(&o.seed, "seed", int(time.Now().UnixNano()%(1<<31)), "random seed")
+	fs.StringVar(&o.out, "out", "hgtsim", "output prefix")
+	fs.IntVar(&o.pairs, "pairs", 0, "number of random pairs used for covariances (0 for all pairs)")
+	fs.IntVar(&o.ref, "ref", -1, "reference genome compared with the others (-1 for none)")
+	fs.StringVar(&o.format, "format", "fasta", "output format of sequences: fasta, phylip, nexus or vcf")
+}
+
+// set the genome topologies from the flags, def being the default of the simulator.
+// Covariances are linear unless -circle or -topology is given.
+func (o *options) setTopology(def genome.Topology) {
+	o.topology = def
+	o.covTopology = genome.Linear
+	if o.circle {
+		o.covTopology = genome.Circular
+	}
+	if o.shape != "" {
+		t, err := genome.ParseTopology(o.shape)
+		if err != nil {
+			log.Fatal(err)
+		}
+		o.topology, o.covTopology = t, t
+	}
+}
+
+// write the sample and its statistics into <out>.<format> and <out>_covs.txt,
+// rng is used to draw random pairs.
+func (o *options) write(sample []fwd.Sequence, rng fwd.Rand) {
+	if o.ref >= len(sample) {
+		log.Fatalf("-ref %d should be less than the sample size %d", o.ref, len(sample))
+	}
+	o.writeSequences(sample)
+	o.writeCovs(o.out+"_covs.txt", sample, rng)
+}
+
+// sequence writers and file extensions of the output formats
+var formats = map[string]struct {
+	ext   string
+	write func(w io.Writer, sample []fwd.Sequence) error
+}{
+	"fasta":  {"fasta", func(w io.Writer, s []fwd.Sequence) error { return fwd.WriteFasta(w, nil, s) }},
+	"phylip": {"phy", func(w io.Writer, s []fwd.Sequence) error { return fwd.WritePhylip(w, nil, s) }},
+	"nexus":  {"nex", func(w io.Writer, s []fwd.Sequence) error { return fwd.WriteNexus(w, nil, s) }},
+	"vcf":    {"vcf", func(w io.Writer, s []fwd.Sequence) error { return fwd.WriteVCF(w, nil, s, nil) }},
+}
+
+// write sequences in the chosen format
+func (o *options) writeSequences(sample []fwd.Sequence) {
+	format, found := formats[o.format]
+	if !found {
+		log.Fatalf("unknown format: %s\n", o.format)
+	}
+
+	writeFile(o.out+"."+format.ext, func(w io.Writer) error { return format.write(w, sample) })
+}
+
+// create a file and write it through a buffer, exiting on any error of the writes, the flush or the close
+func writeFile(filename string, write func(w io.Writer) error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		f.Close()
+		log.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// calculate KS, VarD and covariances of a sample,
+// and write them into a file.
+// when pairs are subsampled, standard errors are written as well.
+func (o *options) writeCovs(filename string, sample []fwd.Sequence, rng fwd.Rand) {
+	var jk *covs.Jackknife
+	if o.ref >= 0 {
+		jk = fwd.ReferenceCovs(sample, o.ref, o.maxl, o.covTopology)
+	} else if o.pairs > 0 {
+		pairs, err := fwd.RandomPairs(rng, len(sample), o.pairs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		jk = fwd.PairCovs(sample, pairs, o.maxl, o.covTopology)
+	}
+
+	var ks, vd, ksErr, vdErr float64
+	var scovs, rcovs, xyPL, xsysPL, smXYPL []float64
+	var scovsErr, rcovsErr []float64
+	if jk != nil {
+		ks, vd = jk.D()
+		ksErr, vdErr = jk.DErr()
+		scovs, rcovs, xyPL, xsysPL, smXYPL = jk.Cov()
+		scovsErr, rcovsErr, _, _, _ = jk.CovErr()
+	} else {
+		counter := fwd.StreamCovs(sample, o.maxl, o.covTopology)
+		ks, vd = counter.D()
+		scovs, rcovs, xyPL, xsysPL, smXYPL = counter.Cov()
+	}
+
+	writeFile(filename, func(w io.Writer) error {
+		if jk != nil {
+			fmt.Fprintf(w, "#KS\t%g\t%g\n", ks, ksErr)
+			fmt.Fprintf(w, "#VarD\t%g\t%g\n", vd, vdErr)
+			fmt.Fprintln(w, "#l\tscov\trcov\txy\txsys\tsmxy\tscov_se\trcov_se")
+		} else {
+			fmt.Fprintf(w, "#KS\t%g\n", ks)
+			fmt.Fprintf(w, "#VarD\t%g\n", vd)
+			fmt.Fprintln(w, "#l\tscov\trcov\txy\txsys\tsmxy")
+		}
+		for l := 0; l < o.maxl; l++ {
+			fmt.Fprintf(w, "%d\t%g\t%g\t%g\t%g\t%g", l, scovs[l], rcovs[l], xyPL[l], xsysPL[l], smXYPL[l])
+			if jk != nil {
+				fmt.Fprintf(w, "\t%g\t%g", scovsErr[l], rcovsErr[l])
+			}
+			fmt.Fprintln(w)
+		}
+		return nil
+	})
+	log.Printf("KS = %g, VarD = %g\n", ks, vd)
+}
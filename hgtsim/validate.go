@@ -0,0 +1,172 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mingzhi/hgt/coals"
+	"github.com/mingzhi/hgt/fwd"
+	"github.com/mingzhi/hgt/genome"
+	"github.com/mingzhi/hgt/simtest"
+	"io"
+	"log"
+	"math"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// statistics of the samples of a simulator over replicates
+type replicates struct {
+	ks, vd simtest.Sample
+	scovs  []simtest.Sample // scovs[l][r]: structure covariance at distance l in replicate r
+}
+
+func newReplicates(n, maxl int) *replicates {
+	r := &replicates{ks: make(simtest.Sample, n), vd: make(simtest.Sample, n), scovs: make([]simtest.Sample, maxl)}
+	for l := range r.scovs {
+		r.scovs[l] = make(simtest.Sample, n)
+	}
+	return r
+}
+
+// record the statistics of the sample of replicate i
+func (r *replicates) add(i int, sample []fwd.Sequence, maxl int, topology genome.Topology) {
+	counter := fwd.StreamCovs(sample, maxl, topology)
+	r.ks[i], r.vd[i] = counter.D()
+	scovs, _, _, _, _ := counter.Cov()
+	for l := range r.scovs {
+		r.scovs[l][i] = scovs[l]
+	}
+}
+
+// validate: simulate matched parameters with the forward (fwd.SeqPop) and the coalescent (coals.WFPopulation) simulators,
+// and compare the distributions of KS, VarD and covariances over replicates
+// with Welch's t test of the means and the two-sample Kolmogorov-Smirnov test,
+// p values being adjusted by Holm's method over all the tests.
+// The report is written into <out>_validate.txt, and the command exits with status 1 if a test fails.
+func runValidate(args []string) {
+	var (
+		size, length, fragment int
+		mutation, transfer     float64
+		gens, reps, sample     int
+		maxl, step, seed       int
+		alpha                  float64
+		shape, out             string
+	)
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.IntVar(&size, "size", 100, "population size")
+	fs.IntVar(&length, "length", 1000, "genome length")
+	fs.Float64Var(&mutation, "mutation", 1e-4, "mutation rate per site")
+	fs.Float64Var(&transfer, "transfer", 1e-4, "transfer rate per position where a fragment can begin, as in fwd; the coalescent rate per genome is transfer times the positions")
+	fs.IntVar(&fragment, "fragment", 100, "transferred fragment length")
+	fs.IntVar(&gens, "gens", 0, "generations of the forward simulations (0 for 10*size)")
+	fs.IntVar(&reps, "replicates", 30, "number of replicates of each simulator")
+	fs.IntVar(&sample, "sample", 20, "sample size")
+	fs.IntVar(&maxl, "maxl", 100, "maximum distance of covariances")
+	fs.IntVar(&step, "step", 10, "compare the covariances every step distances")
+	fs.Float64Var(&alpha, "alpha", 0.01, "significance level of the tests, after adjustment")
+	fs.StringVar(&shape, "topology", "circular", "genome topology: circular or linear")
+	fs.IntVar(&seed, "seed", int(time.Now().UnixNano()%(1<<31)), "random seed of the first replicate")
+	fs.StringVar(&out, "out", "hgtsim", "output prefix")
+	fs.Parse(args)
+
+	topology, err := genome.ParseTopology(shape)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if gens == 0 {
+		gens = 10 * size
+	}
+	if step <= 0 || reps < 2 {
+		log.Fatal("-step should be positive, and -replicates at least 2")
+	}
+
+	forward := newReplicates(reps, maxl)
+	backward := newReplicates(reps, maxl)
+	parallel(reps, func(r int) {
+		pop := fwd.NewSeqPop(size, length, mutation, transfer, fragment)
+		pop.SetTopology(topology)
+		pop.Seed(seed + r)
+		for i := 0; i < gens; i++ {
+			pop.Evolve()
+		}
+		genomes, err := fwd.RandomSample(pop, sample, false)
+		if err != nil {
+			log.Fatal(err)
+		}
+		forward.add(r, fwd.Sequences(genomes), maxl, topology)
+
+		lo, hi := topology.Starts(fragment, length)
+		w := coals.NewWFPopulation(size, sample, length, mutation, transfer*float64(hi-lo), fragment)
+		w.Topology = topology
+		w.Seed(seed + r)
+		if err := w.Backtrace(); err != nil {
+			log.Fatal(err)
+		}
+		seqMap := w.Fortrace()
+		seqs := make([]fwd.Sequence, sample)
+		for i := range seqs {
+			seqs[i] = seqMap[i]
+		}
+		backward.add(r, seqs, maxl, topology)
+	})
+
+	// statistics compared, with the replicates of both simulators
+	names := []string{"KS", "VarD"}
+	values := [][2]simtest.Sample{{forward.ks, backward.ks}, {forward.vd, backward.vd}}
+	for l := 0; l < maxl; l += step {
+		names = append(names, fmt.Sprintf("scov_%d", l))
+		values = append(values, [2]simtest.Sample{forward.scovs[l], backward.scovs[l]})
+	}
+	ps := []float64{}
+	for _, v := range values {
+		ps = append(ps, simtest.WelchTest(v[0], v[1]), simtest.KSTest2(v[0], v[1]))
+	}
+	adjusted := simtest.Holm(ps)
+
+	filename := out + "_validate.txt"
+	failed := 0
+	writeFile(filename, func(wr io.Writer) error {
+		fmt.Fprintf(wr, "#size\t%d\n#length\t%d\n#mutation\t%g\n#transfer\t%g\n#fragment\t%d\n#topology\t%v\n", size, length, mutation, transfer, fragment, topology)
+		fmt.Fprintf(wr, "#gens\t%d\n#replicates\t%d\n#sample\t%d\n#seed\t%d\n#alpha\t%g\n", gens, reps, sample, seed, alpha)
+		fmt.Fprintln(wr, "#statistic\tfwd_mean\tfwd_se\tcoals_mean\tcoals_se\twelch_p\tks_p\tadjusted_p\tresult")
+		for i, name := range names {
+			fw, bw := values[i][0], values[i][1]
+			p := math.Min(adjusted[2*i], adjusted[2*i+1])
+			result := "ok"
+			if p < alpha {
+				result = "FAIL"
+				failed++
+			}
+			fmt.Fprintf(wr, "%s\t%g\t%g\t%g\t%g\t%g\t%g\t%g\t%s\n", name, fw.Mean(), fw.SE(), bw.Mean(), bw.SE(), ps[2*i], ps[2*i+1], p, result)
+		}
+		return nil
+	})
+
+	if failed > 0 {
+		log.Printf("%d of %d statistics differ between the forward and the coalescent simulations, see %s\n", failed, len(names), filename)
+		os.Exit(1)
+	}
+	log.Printf("the forward and the coalescent simulations agree on %d statistics, see %s\n", len(names), filename)
+}
+
+// run job(0) ... job(n-1) on all cpus
+func parallel(n int, job func(i int)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				job(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,129 @@
+package popgen
+
+import (
+	"github.com/mingzhi/hgt/fwd"
+	"github.com/mingzhi/hgt/genome"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// Alignment converts aligned byte sequences, e.g. read from a FASTA file, into a sample.
+func Alignment(aln [][]byte) []fwd.Sequence {
+	seqs := make([]fwd.Sequence, len(aln))
+	for i, a := range aln {
+		seqs[i] = fwd.Sequence(a)
+	}
+	return seqs
+}
+
+// a biallelic site, whose sequences carrying the second allele are marked in a bitset.
+type biallelic struct {
+	pos  int      // position in the genome
+	freq float64  // frequency of the second allele
+	bits []uint64 // sequences carrying the second allele
+}
+
+// find biallelic sites; sites with more than two alleles are skipped.
+func biallelicSites(seqs []fwd.Sequence) (sites []biallelic) {
+	n := len(seqs)
+	words := (n + 63) / 64
+	if n == 0 {
+		return
+	}
+	for k := 0; k < len(seqs[0]); k++ {
+		s := countSite(seqs, k)
+		if len(s.alleles) != 2 {
+			continue
+		}
+		b := biallelic{pos: k, freq: float64(s.counts[1]) / float64(n), bits: make([]uint64, words)}
+		for i, seq := range seqs {
+			if seq[k] == s.alleles[1] {
+				b.bits[i/64] |= 1 << uint(i%64)
+			}
+		}
+		sites = append(sites, b)
+	}
+	return
+}
+
+// r2 and D' of two biallelic sites of n sequences.
+func linkage(a, b biallelic, n int) (r2, dprime float64) {
+	count := 0
+	for w := range a.bits {
+		count += bits.OnesCount64(a.bits[w] & b.bits[w])
+	}
+	pA, pB := a.freq, b.freq
+	d := float64(count)/float64(n) - pA*pB
+	r2 = d * d / (pA * (1 - pA) * pB * (1 - pB))
+	var dmax float64
+	if d > 0 {
+		dmax = math.Min(pA*(1-pB), (1-pA)*pB)
+	} else {
+		dmax = math.Min(pA*pB, (1-pA)*(1-pB))
+	}
+	if dmax > 0 {
+		dprime = math.Abs(d) / dmax
+	}
+	return
+}
+
+// LD returns the mean r2 and |D'| between pairs of biallelic segregating sites,
+// binned by their distance l = 0 ... maxL-1, and the number of pairs in each bin.
+// Distances follow covs.CMatrix.CovTopology:
+// on a linear genome the distance of sites x < y is y - x;
+// on a circular genome a pair is counted at y - x and at L - (y - x),
+// for both directions around the circle.
+// Bins without any pair are NaN.
+func LD(seqs []fwd.Sequence, maxL int, topology genome.Topology) (r2, dprime []float64, counts []int) {
+	r2 = make([]float64, maxL)
+	dprime = make([]float64, maxL)
+	counts = make([]int, maxL)
+	if len(seqs) == 0 || maxL <= 0 {
+		return
+	}
+	n := len(seqs)
+	length := len(seqs[0])
+	sites := biallelicSites(seqs)
+
+	add := func(l int, r, d float64) {
+		if l < maxL {
+			r2[l] += r
+			dprime[l] += d
+			counts[l]++
+		}
+	}
+	pair := func(a, b biallelic) {
+		l := b.pos - a.pos
+		r, d := linkage(a, b, n)
+		add(l, r, d)
+		if topology == genome.Circular {
+			add(length-l, r, d)
+		}
+	}
+	for i, a := range sites {
+		add(0, 1, 1)
+		// nearby sites
+		j := i + 1
+		for ; j < len(sites) && sites[j].pos-a.pos < maxL; j++ {
+			pair(a, sites[j])
+		}
+		// sites close around the end of a circular genome
+		if topology == genome.Circular {
+			far := j + sort.Search(len(sites)-j, func(k int) bool { return length-(sites[j+k].pos-a.pos) < maxL })
+			for k := far; k < len(sites); k++ {
+				pair(a, sites[k])
+			}
+		}
+	}
+
+	for l := 0; l < maxL; l++ {
+		if counts[l] == 0 {
+			r2[l], dprime[l] = math.NaN(), math.NaN()
+		} else {
+			r2[l] /= float64(counts[l])
+			dprime[l] /= float64(counts[l])
+		}
+	}
+	return
+}
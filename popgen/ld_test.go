@@ -0,0 +1,53 @@
+package popgen
+
+import (
+	"github.com/mingzhi/hgt/fwd"
+	"github.com/mingzhi/hgt/genome"
+	"math"
+	"testing"
+)
+
+func TestLD(t *testing.T) {
+	seqs := Alignment([][]byte{
+		[]byte("AAAAAAAAAA"),
+		[]byte("TATAAAAAAT"),
+		[]byte("TATAAAAAAT"),
+		[]byte("AAAAAAAAAA"),
+	})
+	// sites 0 and 2 are in complete LD, site 9 as well.
+	r2, dprime, counts := LD(seqs, 3, genome.Linear)
+	if counts[0] != 3 || counts[1] != 0 || counts[2] != 1 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+	if r2[0] != 1 || r2[2] != 1 || dprime[2] != 1 {
+		t.Errorf("expected complete LD, but got r2 = %v, D' = %v", r2, dprime)
+	}
+	if !math.IsNaN(r2[1]) {
+		t.Errorf("expected NaN for an empty bin, but got %g", r2[1])
+	}
+
+	// on a circular genome, sites 9 and 0 are at distance 1 (and 9).
+	_, _, counts = LD(seqs, 3, genome.Circular)
+	if counts[1] != 1 || counts[2] != 1 {
+		t.Errorf("unexpected circular counts %v", counts)
+	}
+}
+
+func TestLinkage(t *testing.T) {
+	seqs := []fwd.Sequence{
+		fwd.Sequence("AA"),
+		fwd.Sequence("AT"),
+		fwd.Sequence("TA"),
+		fwd.Sequence("TT"),
+		fwd.Sequence("TT"),
+	}
+	sites := biallelicSites(seqs)
+	r2, dprime := linkage(sites[0], sites[1], len(seqs))
+	// pA = 0.6, pB = 0.6, pAB = 0.4, D = 0.04
+	if math.Abs(r2-0.04*0.04/(0.24*0.24)) > 1e-12 {
+		t.Errorf("unexpected r2 %g", r2)
+	}
+	if math.Abs(dprime-0.04/0.24) > 1e-12 {
+		t.Errorf("unexpected D' %g", dprime)
+	}
+}
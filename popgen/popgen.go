@@ -0,0 +1,328 @@
+// Package popgen calculates classical population genetic statistics
+// of a sample of aligned sequences,
+// so that simulated populations and real alignments are summarized in the same way.
+// Statistics such as theta and pi are per sequence, not per site;
+// divide them by the sequence length for per-site values.
+package popgen
+
+import (
+	"github.com/mingzhi/hgt/fwd"
+	"math"
+)
+
+// Summary of a sample.
+type Summary struct {
+	Size             int     // sample size
+	Length           int     // sequence length
+	SegregatingSites int     // number of segregating sites
+	Mutations        int     // minimum number of mutations
+	Singletons       int     // number of singleton mutations
+	Theta            float64 // Watterson's theta
+	Pi               float64 // nucleotide diversity
+	TajimaD          float64 // Tajima's D
+	FuLiDStar        float64 // Fu and Li's D*
+	FuLiFStar        float64 // Fu and Li's F*
+	Haplotypes       int     // number of distinct haplotypes
+	HapDiversity     float64 // haplotype diversity
+}
+
+// Summarize calculates all statistics which do not need an ancestral sequence.
+func Summarize(seqs []fwd.Sequence) Summary {
+	s := Summary{Size: len(seqs)}
+	if len(seqs) > 0 {
+		s.Length = len(seqs[0])
+	}
+	s.SegregatingSites = SegregatingSites(seqs)
+	s.Mutations = Mutations(seqs)
+	s.Singletons = Singletons(seqs)
+	s.Theta = WattersonTheta(seqs)
+	s.Pi = Pi(seqs)
+	s.TajimaD = TajimaD(seqs)
+	s.FuLiDStar = FuLiDStar(seqs)
+	s.FuLiFStar = FuLiFStar(seqs)
+	s.Haplotypes, s.HapDiversity = Haplotypes(seqs)
+	return s
+}
+
+// alleles and their counts at a site.
+type site struct {
+	alleles []byte
+	counts  []int
+}
+
+// count the alleles at position k.
+func countSite(seqs []fwd.Sequence, k int) (s site) {
+	for _, seq := range seqs {
+		found := false
+		for i, a := range s.alleles {
+			if a == seq[k] {
+				s.counts[i]++
+				found = true
+				break
+			}
+		}
+		if !found {
+			s.alleles = append(s.alleles, seq[k])
+			s.counts = append(s.counts, 1)
+		}
+	}
+	return
+}
+
+// visit every site of the sample.
+func eachSite(seqs []fwd.Sequence, f func(s site)) {
+	if len(seqs) == 0 {
+		return
+	}
+	for k := 0; k < len(seqs[0]); k++ {
+		f(countSite(seqs, k))
+	}
+}
+
+// SFS returns the unfolded site frequency spectrum:
+// sfs[i] is the number of derived alleles carried by i sequences,
+// where an allele is derived if it differs from the ancestral sequence.
+// sfs[0] counts monomorphic ancestral sites.
+func SFS(seqs []fwd.Sequence, ancestral fwd.Sequence) []int {
+	n := len(seqs)
+	sfs := make([]int, n+1)
+	for k := 0; k < len(ancestral); k++ {
+		s := countSite(seqs, k)
+		if len(s.alleles) == 1 && s.alleles[0] == ancestral[k] {
+			sfs[0]++
+			continue
+		}
+		for i, a := range s.alleles {
+			if a != ancestral[k] {
+				sfs[s.counts[i]]++
+			}
+		}
+	}
+	return sfs
+}
+
+// FoldedSFS returns the folded site frequency spectrum:
+// sfs[i] is the number of minor alleles carried by i sequences,
+// where the minor alleles of a site are all but one of its most common alleles,
+// and an allele carried by c sequences is binned at min(c, n-c).
+// A site with more than two alleles adds one count for each of its minor alleles,
+// as the unfolded spectrum counts each derived allele.
+// sfs[0] counts monomorphic sites.
+func FoldedSFS(seqs []fwd.Sequence) []int {
+	n := len(seqs)
+	sfs := make([]int, n/2+1)
+	eachSite(seqs, func(s site) {
+		if len(s.alleles) == 1 {
+			sfs[0]++
+			return
+		}
+		major := -1
+		for i, c := range s.counts {
+			if major < 0 || c > s.counts[major] {
+				major = i
+			}
+		}
+		for i, c := range s.counts {
+			if i == major {
+				continue
+			}
+			if n-c < c {
+				c = n - c
+			}
+			sfs[c]++
+		}
+	})
+	return sfs
+}
+
+// SegregatingSites returns the number of polymorphic sites.
+func SegregatingSites(seqs []fwd.Sequence) (count int) {
+	eachSite(seqs, func(s site) {
+		if len(s.alleles) > 1 {
+			count++
+		}
+	})
+	return
+}
+
+// Mutations returns the minimum number of mutations,
+// which is the number of alleles minus one, summed over sites.
+func Mutations(seqs []fwd.Sequence) (count int) {
+	eachSite(seqs, func(s site) {
+		count += len(s.alleles) - 1
+	})
+	return
+}
+
+// Singletons returns the number of alleles carried by only one sequence,
+// counted at polymorphic sites.
+func Singletons(seqs []fwd.Sequence) (count int) {
+	eachSite(seqs, func(s site) {
+		for _, c := range s.counts {
+			if c == 1 {
+				count++
+			}
+		}
+	})
+	return
+}
+
+// ExternalMutations returns the number of derived alleles carried by only one sequence.
+func ExternalMutations(seqs []fwd.Sequence, ancestral fwd.Sequence) int {
+	if len(seqs) < 2 {
+		return 0
+	}
+	return SFS(seqs, ancestral)[1]
+}
+
+// Pi returns the nucleotide diversity,
+// the mean number of differences between two sequences.
+func Pi(seqs []fwd.Sequence) float64 {
+	n := len(seqs)
+	if n < 2 {
+		return 0
+	}
+	diffs := 0 // number of different pairs summed over sites
+	eachSite(seqs, func(s site) {
+		same := 0
+		for _, c := range s.counts {
+			same += c * (c - 1) / 2
+		}
+		diffs += n*(n-1)/2 - same
+	})
+	return float64(diffs) / float64(n*(n-1)/2)
+}
+
+// WattersonTheta returns Watterson's estimator S / a(n).
+func WattersonTheta(seqs []fwd.Sequence) float64 {
+	n := len(seqs)
+	if n < 2 {
+		return 0
+	}
+	return float64(SegregatingSites(seqs)) / harmonic(n-1, 1)
+}
+
+// TajimaD returns Tajima's D, or NaN if there is no segregating site.
+func TajimaD(seqs []fwd.Sequence) float64 {
+	n := float64(len(seqs))
+	s := float64(SegregatingSites(seqs))
+	if n < 4 || s == 0 {
+		return math.NaN()
+	}
+	a1 := harmonic(len(seqs)-1, 1)
+	a2 := harmonic(len(seqs)-1, 2)
+	b1 := (n + 1.0) / (3.0 * (n - 1.0))
+	b2 := 2.0 * (n*n + n + 3.0) / (9.0 * n * (n - 1.0))
+	c1 := b1 - 1.0/a1
+	c2 := b2 - (n+2.0)/(a1*n) + a2/(a1*a1)
+	e1 := c1 / a1
+	e2 := c2 / (a1*a1 + a2)
+	return (Pi(seqs) - s/a1) / math.Sqrt(e1*s+e2*s*(s-1.0))
+}
+
+// FuLiD returns Fu and Li's D using an ancestral (outgroup) sequence,
+// or NaN if there is no mutation.
+func FuLiD(seqs []fwd.Sequence, ancestral fwd.Sequence) float64 {
+	n := float64(len(seqs))
+	eta := float64(Mutations(seqs))
+	if n < 4 || eta == 0 {
+		return math.NaN()
+	}
+	etaE := float64(ExternalMutations(seqs, ancestral))
+	an := harmonic(len(seqs)-1, 1)
+	bn := harmonic(len(seqs)-1, 2)
+	cn := fuLiC(n, an)
+	vD := 1.0 + an*an/(bn+an*an)*(cn-(n+1.0)/(n-1.0))
+	uD := an - 1.0 - vD
+	return (eta - an*etaE) / math.Sqrt(uD*eta+vD*eta*eta)
+}
+
+// FuLiF returns Fu and Li's F using an ancestral (outgroup) sequence,
+// or NaN if there is no mutation.
+func FuLiF(seqs []fwd.Sequence, ancestral fwd.Sequence) float64 {
+	n := float64(len(seqs))
+	eta := float64(Mutations(seqs))
+	if n < 4 || eta == 0 {
+		return math.NaN()
+	}
+	etaE := float64(ExternalMutations(seqs, ancestral))
+	an := harmonic(len(seqs)-1, 1)
+	bn := harmonic(len(seqs)-1, 2)
+	an1 := an + 1.0/n
+	cn := fuLiC(n, an)
+	vF := (cn + 2.0*(n*n+n+3.0)/(9.0*n*(n-1.0)) - 2.0/(n-1.0)) / (an*an + bn)
+	uF := (1.0+(n+1.0)/(3.0*(n-1.0))-4.0*(n+1.0)/((n-1.0)*(n-1.0))*(an1-2.0*n/(n+1.0)))/an - vF
+	return (Pi(seqs) - etaE) / math.Sqrt(uF*eta+vF*eta*eta)
+}
+
+// FuLiDStar returns Fu and Li's D* without an outgroup,
+// or NaN if there is no mutation.
+func FuLiDStar(seqs []fwd.Sequence) float64 {
+	n := float64(len(seqs))
+	eta := float64(Mutations(seqs))
+	if n < 4 || eta == 0 {
+		return math.NaN()
+	}
+	etaS := float64(Singletons(seqs))
+	an := harmonic(len(seqs)-1, 1)
+	bn := harmonic(len(seqs)-1, 2)
+	an1 := an + 1.0/n
+	cn := fuLiC(n, an)
+	dn := cn + (n-2.0)/((n-1.0)*(n-1.0)) + 2.0/(n-1.0)*(1.5-(2.0*an1-3.0)/(n-2.0)-1.0/n)
+	r := n / (n - 1.0)
+	vD := (r*r*bn + an*an*dn - 2.0*n*an*(an+1.0)/((n-1.0)*(n-1.0))) / (an*an + bn)
+	uD := r*(an-r) - vD
+	return (r*eta - an*etaS) / math.Sqrt(uD*eta+vD*eta*eta)
+}
+
+// FuLiFStar returns Fu and Li's F* without an outgroup,
+// using the corrected variance of Simonsen et al. (1995),
+// or NaN if there is no mutation.
+func FuLiFStar(seqs []fwd.Sequence) float64 {
+	n := float64(len(seqs))
+	eta := float64(Mutations(seqs))
+	if n < 4 || eta == 0 {
+		return math.NaN()
+	}
+	etaS := float64(Singletons(seqs))
+	an := harmonic(len(seqs)-1, 1)
+	bn := harmonic(len(seqs)-1, 2)
+	an1 := an + 1.0/n
+	vF := ((2.0*n*n*n+110.0*n*n-255.0*n+153.0)/(9.0*n*n*(n-1.0)) + 2.0*(n-1.0)*an/(n*n) - 8.0*bn/n) / (an*an + bn)
+	uF := (4.0*n*n+19.0*n+3.0-12.0*(n+1.0)*an1)/(3.0*n*(n-1.0))/an - vF
+	return (Pi(seqs) - (n-1.0)/n*etaS) / math.Sqrt(uF*eta+vF*eta*eta)
+}
+
+// Haplotypes returns the number of distinct sequences and the haplotype diversity,
+// the probability that two sequences drawn without replacement differ.
+func Haplotypes(seqs []fwd.Sequence) (count int, diversity float64) {
+	n := len(seqs)
+	counts := make(map[string]int)
+	for _, seq := range seqs {
+		counts[string(seq)]++
+	}
+	count = len(counts)
+	if n < 2 {
+		return
+	}
+	sum := 0.0
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		sum += p * p
+	}
+	diversity = float64(n) / float64(n-1) * (1.0 - sum)
+	return
+}
+
+// sum of 1/i^k, i = 1 ... n.
+func harmonic(n int, k float64) (sum float64) {
+	for i := 1; i <= n; i++ {
+		sum += 1.0 / math.Pow(float64(i), k)
+	}
+	return
+}
+
+// c(n) of Fu and Li (1993).
+func fuLiC(n, an float64) float64 {
+	return 2.0 * (n*an - 2.0*(n-1.0)) / ((n - 1.0) * (n - 2.0))
+}
@@ -0,0 +1,104 @@
+package popgen
+
+import (
+	"github.com/mingzhi/hgt/fwd"
+	"math"
+	"testing"
+)
+
+func testSample() []fwd.Sequence {
+	return []fwd.Sequence{
+		fwd.Sequence("AAAAGAAAAA"),
+		fwd.Sequence("AAAAAAAAAT"),
+		fwd.Sequence("AAAAAAAGAT"),
+		fwd.Sequence("ACAAAAAGAA"),
+		fwd.Sequence("ACAAAAAAAA"),
+	}
+}
+
+func TestSFS(t *testing.T) {
+	seqs := testSample()
+	ancestral := fwd.Sequence("AAAAAAAAAA")
+	sfs := SFS(seqs, ancestral)
+	expected := []int{6, 1, 3, 0, 0, 0}
+	for i := range expected {
+		if sfs[i] != expected[i] {
+			t.Errorf("sfs[%d]: expected %d, but got %d", i, expected[i], sfs[i])
+		}
+	}
+
+	folded := FoldedSFS(seqs)
+	expected = []int{6, 1, 3}
+	for i := range expected {
+		if folded[i] != expected[i] {
+			t.Errorf("folded sfs[%d]: expected %d, but got %d", i, expected[i], folded[i])
+		}
+	}
+
+	// minor alleles of a triallelic site (A A C C G), and of a site with four alleles (A A C G T)
+	folded = FoldedSFS([]fwd.Sequence{fwd.Sequence("AA"), fwd.Sequence("AA"), fwd.Sequence("CC"), fwd.Sequence("CG"), fwd.Sequence("GT")})
+	expected = []int{0, 4, 1}
+	for i := range expected {
+		if folded[i] != expected[i] {
+			t.Errorf("triallelic folded sfs[%d]: expected %d, but got %d", i, expected[i], folded[i])
+		}
+	}
+
+	if e := ExternalMutations(seqs, ancestral); e != 1 {
+		t.Errorf("expected 1 external mutation, but got %d", e)
+	}
+}
+
+func TestDiversity(t *testing.T) {
+	seqs := testSample()
+	if s := SegregatingSites(seqs); s != 4 {
+		t.Errorf("expected 4 segregating sites, but got %d", s)
+	}
+	if s := Singletons(seqs); s != 1 {
+		t.Errorf("expected 1 singleton, but got %d", s)
+	}
+	if pi := Pi(seqs); math.Abs(pi-2.2) > 1e-12 {
+		t.Errorf("expected pi = 2.2, but got %g", pi)
+	}
+	if theta := WattersonTheta(seqs); math.Abs(theta-4.0/(1.0+1.0/2.0+1.0/3.0+1.0/4.0)) > 1e-12 {
+		t.Errorf("unexpected Watterson's theta %g", theta)
+	}
+	if d := TajimaD(seqs); math.Abs(d-0.957074182595578) > 1e-9 {
+		t.Errorf("expected Tajima's D = 0.957074, but got %g", d)
+	}
+	for _, d := range []float64{FuLiDStar(seqs), FuLiFStar(seqs), FuLiD(seqs, seqs[0]), FuLiF(seqs, seqs[0])} {
+		if math.IsNaN(d) || math.IsInf(d, 0) {
+			t.Errorf("invalid Fu and Li's statistic %g", d)
+		}
+	}
+
+	k, h := Haplotypes(append(seqs, seqs[0]))
+	if k != 5 {
+		t.Errorf("expected 5 haplotypes, but got %d", k)
+	}
+	if math.Abs(h-(1.0-(4.0/36.0+1.0/9.0))*6.0/5.0) > 1e-12 {
+		t.Errorf("unexpected haplotype diversity %g", h)
+	}
+}
+
+func TestNeutrality(t *testing.T) {
+	// a star-like sample with excess singletons has negative D
+	seqs := []fwd.Sequence{}
+	for i := 0; i < 10; i++ {
+		seq := make(fwd.Sequence, 10)
+		for j := range seq {
+			seq[j] = 'A'
+		}
+		seq[i] = 'T'
+		seqs = append(seqs, seq)
+	}
+	if d := TajimaD(seqs); d >= 0 {
+		t.Errorf("expected negative Tajima's D, but got %g", d)
+	}
+	if d := FuLiDStar(seqs); d >= 0 {
+		t.Errorf("expected negative Fu and Li's D*, but got %g", d)
+	}
+	if f := FuLiFStar(seqs); f >= 0 {
+		t.Errorf("expected negative Fu and Li's F*, but got %g", f)
+	}
+}
@@ -0,0 +1,161 @@
+package simtest
+
+import (
+	"math"
+)
+
+// NormalCDF: the distribution function of the standard normal distribution.
+func NormalCDF(x float64) float64 {
+	return math.Erfc(-x/math.Sqrt2) / 2
+}
+
+// ExponentialCDF returns the distribution function of the exponential distribution of a mean.
+func ExponentialCDF(mean float64) func(float64) float64 {
+	return func(x float64) float64 {
+		if x <= 0 {
+			return 0
+		}
+		return -math.Expm1(-x / mean)
+	}
+}
+
+// StudentP returns the two-sided p value of t with df degrees of freedom.
+func StudentP(t, df float64) float64 {
+	return IncompleteBeta(df/2, 0.5, df/(df+t*t))
+}
+
+// StudentQuantile returns the quantile of probability p of Student's t distribution with df degrees of freedom.
+func StudentQuantile(p, df float64) float64 {
+	if p < 0.5 {
+		return -StudentQuantile(1-p, df)
+	}
+	// bisection on the two-sided p value, which decreases with t
+	target := 2 * (1 - p)
+	lo, hi := 0.0, 1.0
+	for StudentP(hi, df) > target {
+		lo, hi = hi, 2*hi
+	}
+	for i := 0; i < 100 && hi-lo > 1e-12*hi; i++ {
+		mid := (lo + hi) / 2
+		if StudentP(mid, df) > target {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// ChiSquareQ returns the survival function of the chi-square distribution with df degrees of freedom.
+func ChiSquareQ(x, df float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	return 1 - IncompleteGamma(df/2, x/2)
+}
+
+// KolmogorovQ: Q(lambda) = 2 sum_j (-1)^(j-1) exp(-2 j^2 lambda^2), the survival function of the Kolmogorov distribution.
+func KolmogorovQ(lambda float64) float64 {
+	if lambda < 0.2 {
+		return 1
+	}
+	sum, sign := 0.0, 1.0
+	for j := 1; j <= 100; j++ {
+		term := sign * 2 * math.Exp(-2*float64(j*j)*lambda*lambda)
+		sum += term
+		if math.Abs(term) < 1e-12 {
+			break
+		}
+		sign = -sign
+	}
+	return math.Max(0, math.Min(1, sum))
+}
+
+// IncompleteGamma returns the regularized lower incomplete gamma function P(a, x),
+// by its series for x < a + 1, and by the continued fraction of its complement otherwise (Numerical Recipes).
+func IncompleteGamma(a, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	lga, _ := math.Lgamma(a)
+	front := math.Exp(-x + a*math.Log(x) - lga)
+	if x < a+1 {
+		sum, term := 1/a, 1/a
+		for n := 1; n <= 1000; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-15 {
+				break
+			}
+		}
+		return math.Min(1, sum*front)
+	}
+
+	const tiny = 1e-300
+	b := x + 1 - a
+	c, d := 1/tiny, 1/b
+	h := d
+	for i := 1; i <= 1000; i++ {
+		an := -float64(i) * (float64(i) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		if math.Abs(d*c-1) < 1e-15 {
+			break
+		}
+	}
+	return math.Max(0, 1-front*h)
+}
+
+// IncompleteBeta returns the regularized incomplete beta function I_x(a, b), by the continued fraction of Numerical Recipes.
+func IncompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaFraction(a, b, x) / a
+	}
+	return 1 - front*betaFraction(b, a, 1-x)/b
+}
+
+func betaFraction(a, b, x float64) float64 {
+	const tiny = 1e-300
+	clamp := func(v float64) float64 {
+		if math.Abs(v) < tiny {
+			return tiny
+		}
+		return v
+	}
+	c, d := 1.0, 1/clamp(1-(a+b)*x/(a+1))
+	h := d
+	for m := 1; m <= 300; m++ {
+		fm := float64(m)
+		aa := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 / clamp(1+aa*d)
+		c = clamp(1 + aa/c)
+		h *= d * c
+		aa = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 / clamp(1+aa*d)
+		c = clamp(1 + aa/c)
+		h *= d * c
+		if math.Abs(d*c-1) < 1e-12 {
+			break
+		}
+	}
+	return h
+}
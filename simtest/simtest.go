@@ -0,0 +1,187 @@
+// Package simtest helps to test stochastic simulations without flaky failures.
+//
+// A test draws its seed with Seed, the same in every run,
+// so that a failure can be reproduced, and collects independent replicates of a statistic into a Sample.
+// Its expectations are statistical tests gathered in a Family,
+// whose p values are adjusted together by Holm's method,
+// so that a correct simulator fails the whole test with probability at most the level of the family,
+// however many tests it makes.
+package simtest
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// SeedEnv: the environment variable overriding the seeds of the tests,
+// to check that a test passes with other seeds than its own.
+const SeedEnv = "SIMTEST_SEED"
+
+// Seed returns the seed of a test, drawn from its name, or from SIMTEST_SEED and its name if set.
+// The seed is logged, so that it is shown with the failures of the test.
+func Seed(tb testing.TB) int {
+	tb.Helper()
+	h := fnv.New32a()
+	if s := os.Getenv(SeedEnv); s != "" {
+		if _, err := strconv.Atoi(s); err != nil {
+			tb.Fatalf("simtest: %s should be an integer, got %q", SeedEnv, s)
+		}
+		h.Write([]byte(s + "/"))
+	}
+	h.Write([]byte(tb.Name()))
+	seed := int(h.Sum32()&math.MaxInt32) + 1
+	tb.Logf("simtest: seed %d", seed)
+	return seed
+}
+
+// Sample: independent replicates of a statistic.
+type Sample []float64
+
+// Replicate returns n replicates of a statistic, replicate i being f(seed + i).
+func Replicate(n, seed int, f func(seed int) float64) Sample {
+	s := make(Sample, n)
+	for i := range s {
+		s[i] = f(seed + i)
+	}
+	return s
+}
+
+// ReplicateAll returns n replicates of several statistics computed together,
+// samples[k] holding the replicates of the k-th value returned by f.
+func ReplicateAll(n, seed int, f func(seed int) []float64) (samples []Sample) {
+	for i := 0; i < n; i++ {
+		values := f(seed + i)
+		if samples == nil {
+			samples = make([]Sample, len(values))
+			for k := range samples {
+				samples[k] = make(Sample, n)
+			}
+		}
+		for k, v := range values {
+			samples[k][i] = v
+		}
+	}
+	return
+}
+
+// Mean of the replicates.
+func (s Sample) Mean() float64 {
+	m := 0.0
+	for _, v := range s {
+		m += v
+	}
+	return m / float64(len(s))
+}
+
+// Variance: the unbiased variance of the replicates.
+func (s Sample) Variance() float64 {
+	m := s.Mean()
+	ss := 0.0
+	for _, v := range s {
+		ss += (v - m) * (v - m)
+	}
+	return ss / float64(len(s)-1)
+}
+
+// SE: the standard error of the mean.
+func (s Sample) SE() float64 {
+	return math.Sqrt(s.Variance() / float64(len(s)))
+}
+
+// CI returns the confidence interval of the mean at a level, such as 0.99, by Student's t distribution.
+func (s Sample) CI(level float64) (lo, hi float64) {
+	m, se := s.Mean(), s.SE()
+	t := StudentQuantile(1-(1-level)/2, float64(len(s)-1))
+	return m - t*se, m + t*se
+}
+
+// sorted copy of the replicates.
+func (s Sample) sorted() []float64 {
+	x := append([]float64{}, s...)
+	sort.Float64s(x)
+	return x
+}
+
+func (s Sample) String() string {
+	return fmt.Sprintf("%g ± %g (n = %d)", s.Mean(), s.SE(), len(s))
+}
+
+// InCI checks that the confidence interval of the mean at a level contains the expected value,
+// and reports an error otherwise. It is a single test: use a Family for several.
+func InCI(tb testing.TB, name string, s Sample, expected, level float64) bool {
+	tb.Helper()
+	lo, hi := s.CI(level)
+	if expected < lo || expected > hi {
+		tb.Errorf("%s: expected %g, but got %v, out of the %g confidence interval [%g, %g]", name, expected, s, level, lo, hi)
+		return false
+	}
+	return true
+}
+
+// Family: the statistical tests of a test function, adjusted together for multiple testing.
+type Family struct {
+	Alpha float64 // probability of a false failure of the family
+	tb    testing.TB
+	names []string
+	ps    []float64
+}
+
+// NewFamily returns an empty family of tests at level alpha, such as 0.001.
+func NewFamily(tb testing.TB, alpha float64) *Family {
+	return &Family{Alpha: alpha, tb: tb}
+}
+
+// Add records the p value of a test.
+func (f *Family) Add(name string, p float64) {
+	f.names = append(f.names, name)
+	f.ps = append(f.ps, p)
+}
+
+// Mean tests that the mean of the sample is the expected value, by Student's t test.
+func (f *Family) Mean(name string, s Sample, expected float64) {
+	f.Add(fmt.Sprintf("%s: expected mean %g, but got %v", name, expected, s), TTest(s, expected))
+}
+
+// Z tests that an estimate with a known standard error is the expected value.
+func (f *Family) Z(name string, estimate, se, expected float64) {
+	f.Add(fmt.Sprintf("%s: expected %g, but got %g ± %g", name, expected, estimate, se), ZTest(estimate, se, expected))
+}
+
+// Equal tests that two samples have the same mean, by Welch's t test.
+func (f *Family) Equal(name string, a, b Sample) {
+	f.Add(fmt.Sprintf("%s: expected equal means, but got %v and %v", name, a, b), WelchTest(a, b))
+}
+
+// ChiSquare tests observed counts against their expected counts.
+func (f *Family) ChiSquare(name string, observed, expected []float64) {
+	f.Add(fmt.Sprintf("%s: observed counts %v differ from expected %v", name, observed, expected), ChiSquareTest(observed, expected))
+}
+
+// KS tests that the sample is drawn from a distribution function.
+func (f *Family) KS(name string, s Sample, cdf func(float64) float64) {
+	f.Add(fmt.Sprintf("%s: %v does not follow the distribution", name, s), KSTest(s, cdf))
+}
+
+// KS2 tests that two samples are drawn from the same distribution.
+func (f *Family) KS2(name string, a, b Sample) {
+	f.Add(fmt.Sprintf("%s: %v and %v have different distributions", name, a, b), KSTest2(a, b))
+}
+
+// Check adjusts the p values of the family by Holm's method,
+// reports an error for each rejected test, and returns whether all passed.
+func (f *Family) Check() bool {
+	f.tb.Helper()
+	passed := true
+	for i, p := range Holm(f.ps) {
+		if p < f.Alpha {
+			f.tb.Errorf("%s (p = %.3g, adjusted %.3g)", f.names[i], f.ps[i], p)
+			passed = false
+		}
+	}
+	return passed
+}
@@ -0,0 +1,159 @@
+package simtest
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDistributions(t *testing.T) {
+	cases := []struct {
+		name          string
+		got, expected float64
+	}{
+		{"normal cdf at 1.96", NormalCDF(1.96), 0.9750021},
+		{"t p value of 2.228 with 10 df", StudentP(2.228, 10), 0.05},
+		{"t quantile 0.975 with 10 df", StudentQuantile(0.975, 10), 2.228139},
+		{"t quantile 0.025 with 4 df", StudentQuantile(0.025, 4), -2.776445},
+		{"chi-square survival of 3.841 with 1 df", ChiSquareQ(3.841459, 1), 0.05},
+		{"chi-square survival of 18.307 with 10 df", ChiSquareQ(18.307038, 10), 0.05},
+		{"chi-square survival of 150 with 100 df", ChiSquareQ(150, 100), 0.000898},
+		{"kolmogorov survival at 1.358", KolmogorovQ(1.358099), 0.05},
+	}
+	for _, c := range cases {
+		if math.Abs(c.got-c.expected) > 1e-4*math.Max(1, math.Abs(c.expected)) {
+			t.Errorf("%s: expected %g, but got %g", c.name, c.expected, c.got)
+		}
+	}
+}
+
+func TestHolm(t *testing.T) {
+	adjusted := Holm([]float64{0.01, 0.04, 0.03, 0.005})
+	expected := []float64{0.03, 0.06, 0.06, 0.02}
+	for i, p := range adjusted {
+		if math.Abs(p-expected[i]) > 1e-12 {
+			t.Errorf("expected %v, but got %v", expected, adjusted)
+			break
+		}
+	}
+	if b := Bonferroni([]float64{0.01, 0.5}); b[0] != 0.02 || b[1] != 1 {
+		t.Errorf("expected [0.02 1], but got %v", b)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	if Seed(t) != Seed(t) {
+		t.Error("expected the same seed in a test")
+	}
+	t.Run("other", func(u *testing.T) {
+		if Seed(u) == Seed(t) {
+			u.Error("expected different seeds in different tests")
+		}
+	})
+}
+
+// the tests reject true hypotheses at about their level, and false ones almost always.
+func TestSize(t *testing.T) {
+	rng := rand.New(rand.NewSource(int64(Seed(t))))
+	normal := func(n int, mean float64) Sample {
+		s := make(Sample, n)
+		for i := range s {
+			s[i] = mean + rng.NormFloat64()
+		}
+		return s
+	}
+	exponential := func(n int, mean float64) Sample {
+		s := make(Sample, n)
+		for i := range s {
+			s[i] = mean * rng.ExpFloat64()
+		}
+		return s
+	}
+	dice := func(n int) []float64 {
+		counts := make([]float64, 6)
+		for i := 0; i < n; i++ {
+			counts[rng.Intn(6)]++
+		}
+		return counts
+	}
+	fair := []float64{50, 50, 50, 50, 50, 50}
+	tests := []struct {
+		name string
+		test func(null bool) float64
+	}{
+		{"t", func(null bool) float64 {
+			if null {
+				return TTest(normal(10, 0), 0)
+			}
+			return TTest(normal(10, 2), 0)
+		}},
+		{"welch", func(null bool) float64 {
+			if null {
+				return WelchTest(normal(10, 0), normal(30, 0))
+			}
+			return WelchTest(normal(10, 0), normal(30, 2))
+		}},
+		{"z", func(null bool) float64 {
+			s := normal(100, 0)
+			if null {
+				return ZTest(s.Mean(), 0.1, 0)
+			}
+			return ZTest(s.Mean(), 0.1, 0.5)
+		}},
+		{"chi-square", func(null bool) float64 {
+			if null {
+				return ChiSquareTest(dice(300), fair)
+			}
+			return ChiSquareTest(dice(300), []float64{100, 40, 40, 40, 40, 40})
+		}},
+		{"ks", func(null bool) float64 {
+			if null {
+				return KSTest(exponential(50, 1), ExponentialCDF(1))
+			}
+			return KSTest(exponential(50, 2), ExponentialCDF(1))
+		}},
+		{"ks2", func(null bool) float64 {
+			if null {
+				return KSTest2(exponential(50, 1), exponential(40, 1))
+			}
+			return KSTest2(exponential(50, 1), exponential(40, 3))
+		}},
+	}
+
+	replicates := 2000
+	f := NewFamily(t, 1e-3)
+	for _, c := range tests {
+		rejected, power := 0.0, 0.0
+		for r := 0; r < replicates; r++ {
+			if c.test(true) < 0.05 {
+				rejected++
+			}
+			if c.test(false) < 0.05 {
+				power++
+			}
+		}
+		// the asymptotic tests may be a little conservative
+		if rejected > 0.05*float64(replicates) {
+			f.Z(c.name+" size", rejected/float64(replicates), math.Sqrt(0.05*0.95/float64(replicates)), 0.05)
+		}
+		if power < 0.9*float64(replicates) {
+			t.Errorf("%s: expected a power of at least 0.9, but got %g", c.name, power/float64(replicates))
+		}
+	}
+	f.Check()
+}
+
+func TestReplicate(t *testing.T) {
+	s := Replicate(4, 10, func(seed int) float64 { return float64(seed) })
+	if s.Mean() != 11.5 || math.Abs(s.Variance()-5.0/3.0) > 1e-12 {
+		t.Errorf("expected mean 11.5 and variance 5/3, but got %v", s)
+	}
+	all := ReplicateAll(3, 0, func(seed int) []float64 { return []float64{float64(seed), 1} })
+	if len(all) != 2 || all[0][2] != 2 || all[1].Mean() != 1 {
+		t.Errorf("expected two samples, but got %v", all)
+	}
+	lo, hi := Sample{1, 2, 3, 4, 5}.CI(0.95)
+	if math.Abs(lo-1.036757) > 1e-5 || math.Abs(hi-4.963243) > 1e-5 {
+		t.Errorf("expected the interval [1.0368, 4.9632], but got [%g, %g]", lo, hi)
+	}
+}
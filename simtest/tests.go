@@ -0,0 +1,110 @@
+package simtest
+
+import (
+	"math"
+	"sort"
+)
+
+// ZTest returns the two-sided p value of an estimate with a known standard error being the expected value.
+func ZTest(estimate, se, expected float64) float64 {
+	if se == 0 {
+		if estimate == expected {
+			return 1
+		}
+		return 0
+	}
+	return math.Erfc(math.Abs(estimate-expected) / se / math.Sqrt2)
+}
+
+// TTest returns the two-sided p value of Student's t test of the mean of a sample being the expected value.
+func TTest(s Sample, expected float64) float64 {
+	se := s.SE()
+	if se == 0 {
+		return ZTest(s.Mean(), 0, expected)
+	}
+	return StudentP((s.Mean()-expected)/se, float64(len(s)-1))
+}
+
+// WelchTest returns the two-sided p value of Welch's t test of two samples having the same mean.
+func WelchTest(a, b Sample) float64 {
+	v1, v2 := a.Variance()/float64(len(a)), b.Variance()/float64(len(b))
+	if v1+v2 == 0 {
+		return ZTest(a.Mean(), 0, b.Mean())
+	}
+	t := (a.Mean() - b.Mean()) / math.Sqrt(v1+v2)
+	// Welch-Satterthwaite degrees of freedom
+	df := (v1 + v2) * (v1 + v2) / (v1*v1/float64(len(a)-1) + v2*v2/float64(len(b)-1))
+	return StudentP(t, df)
+}
+
+// ChiSquareTest returns the p value of Pearson's chi-square test of observed counts
+// against expected counts of the same total, with one degree of freedom less than the categories.
+// Categories should be expected at least about five times each.
+func ChiSquareTest(observed, expected []float64) float64 {
+	x := 0.0
+	for i, o := range observed {
+		x += (o - expected[i]) * (o - expected[i]) / expected[i]
+	}
+	return ChiSquareQ(x, float64(len(observed)-1))
+}
+
+// KSTest returns the p value of the one-sample Kolmogorov-Smirnov test
+// of a sample being drawn from a continuous distribution function.
+func KSTest(s Sample, cdf func(float64) float64) float64 {
+	x := s.sorted()
+	n := float64(len(x))
+	d := 0.0
+	for i, v := range x {
+		c := cdf(v)
+		d = math.Max(d, math.Max(c-float64(i)/n, float64(i+1)/n-c))
+	}
+	ne := math.Sqrt(n)
+	return KolmogorovQ((ne + 0.12 + 0.11/ne) * d)
+}
+
+// KSTest2 returns the p value of the two-sample Kolmogorov-Smirnov test of two samples
+// being drawn from the same distribution, by the asymptotic distribution
+// with the small-sample correction of Stephens (1970).
+func KSTest2(a, b Sample) float64 {
+	x, y := a.sorted(), b.sorted()
+	d := 0.0
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		v := math.Min(x[i], y[j])
+		for i < len(x) && x[i] == v {
+			i++
+		}
+		for j < len(y) && y[j] == v {
+			j++
+		}
+		d = math.Max(d, math.Abs(float64(i)/float64(len(x))-float64(j)/float64(len(y))))
+	}
+	ne := math.Sqrt(float64(len(x)*len(y)) / float64(len(x)+len(y)))
+	return KolmogorovQ((ne + 0.12 + 0.11/ne) * d)
+}
+
+// Holm returns the p values adjusted for multiple testing by Holm's step-down method,
+// which controls the probability of any false rejection without assuming independent tests.
+func Holm(ps []float64) []float64 {
+	order := make([]int, len(ps))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return ps[order[i]] < ps[order[j]] })
+	adjusted := make([]float64, len(ps))
+	max := 0.0
+	for k, i := range order {
+		max = math.Max(max, math.Min(1, float64(len(ps)-k)*ps[i]))
+		adjusted[i] = max
+	}
+	return adjusted
+}
+
+// Bonferroni returns the p values multiplied by their number, at most 1.
+func Bonferroni(ps []float64) []float64 {
+	adjusted := make([]float64, len(ps))
+	for i, p := range ps {
+		adjusted[i] = math.Min(1, float64(len(ps))*p)
+	}
+	return adjusted
+}